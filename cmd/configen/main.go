@@ -23,6 +23,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
@@ -32,6 +33,8 @@ import (
 
 var version = "dev"
 
+var errDiffArgs = errors.New("diff requires exactly two environments")
+
 func run(args []string) int {
 	opts, err := newOptions(args)
 	if err != nil {
@@ -44,8 +47,39 @@ func run(args []string) int {
 		return 0
 	}
 
-	if err := configen.Generate(&opts.Options, opts.Env...); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	if opts.Check {
+		return check(opts)
+	}
+
+	if opts.Diff {
+		return diff(opts)
+	}
+
+	if opts.Serve {
+		if err := configen.Serve(opts.Port, &opts.Options, opts.Env...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+
+		return 0
+	}
+
+	// the initial run and the runs of watch mode read the same standard input
+	if opts.Watch {
+		if err := configen.BufferStdin(&opts.Options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return 1
+		}
+	}
+
+	report, err := configen.Render(&opts.Options, opts.Env...)
+
+	printPruned(opts, report)
+
+	if err != nil {
+		printErrors(report, err)
 
 		return 1
 	}
@@ -61,6 +95,80 @@ func run(args []string) int {
 	return 0
 }
 
+func check(opts *options) int {
+	drifts, err := configen.Check(&opts.Options, opts.Env...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	for _, drift := range drifts {
+		fmt.Fprint(os.Stdout, drift.Diff)
+	}
+
+	if len(drifts) != 0 {
+		fmt.Fprintf(os.Stderr, "%d output files are out of date\n", len(drifts))
+
+		return 1
+	}
+
+	return 0
+}
+
+func diff(opts *options) int {
+	if len(opts.Env) != 2 {
+		fmt.Fprintln(os.Stderr, errDiffArgs)
+
+		return 1
+	}
+
+	diffs, err := configen.Diff(&opts.Options, opts.Env[0], opts.Env[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	for _, d := range diffs {
+		fmt.Fprint(os.Stdout, d.Diff)
+	}
+
+	if len(diffs) != 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func printPruned(opts *options, report *configen.Report) {
+	if opts.Quiet {
+		return
+	}
+
+	for _, file := range report.Pruned {
+		if opts.Dry {
+			fmt.Fprintf(os.Stderr, "Would remove %s\n", file)
+		} else {
+			fmt.Fprintf(os.Stderr, "Removed %s\n", file)
+		}
+	}
+}
+
+func printErrors(report *configen.Report, err error) {
+	failed := report.Failed()
+
+	if len(failed) == 0 {
+		fmt.Fprintln(os.Stderr, err)
+
+		return
+	}
+
+	for _, file := range failed {
+		fmt.Fprintln(os.Stderr, file.Err)
+	}
+}
+
 func main() {
 	os.Exit(run(os.Args))
 }
@@ -37,7 +37,19 @@ const (
 	desc = `Template based configuration generator.
 
 You can specify multiple environments, input directories and values files.
-Frequently used options has alternative positional argument syntax.`
+Frequently used options has alternative positional argument syntax.
+
+Environments can inherit from other environments (@prod-eu:prod:base),
+values files, template and raw directories are layered along the chain.
+
+The "diff @environment @environment" command shows the differences between
+the output files of two environments.
+
+The "serve" command starts an HTTP server rendering files on demand
+(POST /render with JSON body: env, set, values, format).`
+
+	cmdDiff  = "diff"
+	cmdServe = "serve"
 )
 
 type meta struct {
@@ -45,7 +57,11 @@ type meta struct {
 	Dir     string   `long:"dir" value-name:"directory" description:"Set working directory"`
 	Version bool     `short:"V" long:"version" description:"Show version information"`
 	Watch   bool     `short:"w" long:"watch" description:"Watch and generate on filesystem changes"`
-	Port    int      `long:"port" value-name:"number" env:"PORT" description:"HTTP port for watch mode (default: random)"` //nolint:lll
+	Port    int      `long:"port" value-name:"number" env:"PORT" description:"HTTP port for watch and serve mode (default: random)"` //nolint:lll
+	Check   bool     `long:"check" description:"Check that output files are up to date, print differences"`
+	Config  string   `long:"config" value-name:"file" description:"Project file (default: configen.yaml, configen.toml or configen.json)"` //nolint:lll
+	Diff    bool     `no-flag:"true"`
+	Serve   bool     `no-flag:"true"`
 }
 
 type options struct {
@@ -82,7 +98,24 @@ func newOptions(args []string) (*options, error) {
 		return nil, err
 	}
 
+	if len(positional) > 1 {
+		switch positional[1] {
+		case cmdDiff:
+			opts.Diff = true
+			positional = append(positional[:1], positional[2:]...)
+		case cmdServe:
+			opts.Serve = true
+			positional = append(positional[:1], positional[2:]...)
+		}
+	}
+
 	opts.applyTags(positional)
+	opts.applyInheritance()
+
+	if err := opts.applyProject(); err != nil {
+		return nil, err
+	}
+
 	opts.applyDefaults()
 
 	return opts, err
@@ -205,6 +238,51 @@ func (o *options) applyTag(t string) {
 	o.Templates = append(o.Templates, t)
 }
 
+// applyInheritance splits environment names like "prod-eu:prod:base" into the environment name
+// and the parents of the environments.
+func (o *options) applyInheritance() {
+	for i, env := range o.Env {
+		chain := strings.Split(env, ":")
+
+		o.Env[i] = chain[0]
+
+		for j := 0; j < len(chain)-1; j++ {
+			if o.Inherit == nil {
+				o.Inherit = make(map[string]string)
+			}
+
+			o.Inherit[chain[j]] = chain[j+1]
+		}
+	}
+}
+
+// applyProject sets the options not given on the command line from the project file (if any).
+func (o *options) applyProject() error {
+	path := o.Config
+	if len(path) == 0 {
+		path = configen.FindProject(".")
+	}
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	project, err := configen.LoadProject(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return err
+	}
+
+	if len(o.Env) == 0 {
+		o.Env = project.Envs()
+	}
+
+	project.Apply(&o.Options)
+
+	return nil
+}
+
 var defaultValues = []string{"values.yaml", "values.yml", "values.toml", "values.json", "values.jsonc"}
 
 func findValues() string {
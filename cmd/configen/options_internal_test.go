@@ -52,7 +52,8 @@ func Test_newOptions(t *testing.T) {
 					Output:    "dist",
 					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
 					Raws: []string{"static"}, Package: "package.json",
-					Define: make(map[string]string),
+					Define:       make(map[string]string),
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
 				},
 				meta: meta{Env: []string{""}}, // nolint
 			},
@@ -65,11 +66,89 @@ func Test_newOptions(t *testing.T) {
 					Output:    "dist/{{.Env}}",
 					Values:    []string{"values.json"}, Schemas: []string{"schemas"},
 					Raws: []string{"static"}, Package: "package.json",
-					Define: make(map[string]string),
+					Define:       make(map[string]string),
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
 				},
 				meta: meta{Env: []string{"test", "dev"}}, // nolint
 			},
 		},
+		{
+			name: "diff", args: args{"exe", "diff", "@test", "@dev"},
+			want: &options{
+				Options: configen.Options{ // nolint
+					Templates: []string{"templates"},
+					Output:    "dist/{{.Env}}",
+					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
+					Raws: []string{"static"}, Package: "package.json",
+					Define:       make(map[string]string),
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
+				},
+				meta: meta{Env: []string{"test", "dev"}, Diff: true}, // nolint
+			},
+		},
+		{
+			name: "serve", args: args{"exe", "serve", "@dev"},
+			want: &options{
+				Options: configen.Options{ // nolint
+					Templates: []string{"templates"},
+					Output:    "dist/{{.Env}}",
+					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
+					Raws: []string{"static"}, Package: "package.json",
+					Define:       make(map[string]string),
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
+				},
+				meta: meta{Env: []string{"dev"}, Serve: true}, // nolint
+			},
+		},
+		{
+			name: "inherit", args: args{"exe", "@prod-eu:prod:base", "@dev"},
+			want: &options{
+				Options: configen.Options{ // nolint
+					Templates: []string{"templates"},
+					Output:    "dist/{{.Env}}",
+					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
+					Raws: []string{"static"}, Package: "package.json",
+					Define:       make(map[string]string),
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
+					Inherit: map[string]string{"prod-eu": "prod", "prod": "base"},
+				},
+				meta: meta{Env: []string{"prod-eu", "dev"}}, // nolint
+			},
+		},
+		{
+			name: "set", args: args{"exe", "--set", "db.port:5432", "--set-string", "tag:1.10", "--set-json", "ports:[80]", "--set-file", "cert:tls.pem", "a.b[0]=x"}, // nolint:lll
+			want: &options{
+				Options: configen.Options{ // nolint
+					Templates: []string{"templates"},
+					Output:    "dist",
+					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
+					Raws: []string{"static"}, Package: "package.json",
+					Define:       map[string]string{"db.port": "5432", "a.b[0]": "x"},
+					DefineString: map[string]string{"tag": "1.10"},
+					DefineJSON:   map[string]string{"ports": "[80]"},
+					DefineFile:   map[string]string{"cert": "tls.pem"},
+				},
+				meta: meta{Env: []string{""}}, // nolint
+			},
+		},
+		{
+			name: "project", args: args{"exe", "--config", "project/configen.yaml", "--set", "replicas:3", "--loose"},
+			want: &options{
+				Options: configen.Options{ // nolint
+					Templates: []string{"templates"},
+					Output:    "dist/{{.Env}}",
+					Values:    []string{"values.yaml"}, Schemas: []string{"schemas"},
+					Raws: []string{"static"}, Package: "package.json",
+					Define:       map[string]string{"replicas": "3"},
+					DefineString: make(map[string]string), DefineJSON: make(map[string]string), DefineFile: make(map[string]string),
+					Inherit: map[string]string{"prod": "base"},
+					Loose:   true,
+					Jobs:    2,
+				},
+				meta: meta{Env: []string{"dev", "prod"}, Config: "project/configen.yaml"}, // nolint
+			},
+		},
+		{name: "invalid project", args: args{"exe", "--config", "no-such-project.yaml"}, wantErr: true},
 		{name: "version", args: args{"--version"}, want: &options{Options: configen.Options{}, meta: meta{Version: true}}}, // nolint
 		{name: "invalid dir", args: args{"--dir", "no such dir"}, wantErr: true},
 		{name: "invalid flag", args: args{"--env", "--version"}, wantErr: true},
@@ -3,24 +3,23 @@ module github.com/szkiba/configen
 go 1.16
 
 require (
+	filippo.io/age v1.0.0
 	github.com/Masterminds/sprig/v3 v3.2.2
 	github.com/antonmedv/expr v1.8.9
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gobwas/glob v0.2.3
-	github.com/imdario/mergo v0.3.12
+	github.com/imdario/mergo v0.3.12 // indirect
 	github.com/itchyny/gojq v0.12.3
 	github.com/jessevdk/go-flags v1.5.0
 	github.com/jmespath/go-jmespath v0.4.0
 	github.com/jpillora/longestcommon v0.0.0-20161227235612-adb9d91ee629
 	github.com/kr/text v0.2.0 // indirect
-	github.com/otiai10/copy v1.5.1
 	github.com/pelletier/go-toml v1.9.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/qri-io/jsonpointer v0.1.1
 	github.com/stretchr/testify v1.5.1
 	github.com/xeipuuv/gojsonschema v1.2.0
 	github.com/yosida95/uritemplate/v3 v3.0.1
-	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2 // indirect
-	golang.org/x/sys v0.0.0-20210324051608-47abb6519492 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
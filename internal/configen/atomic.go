@@ -0,0 +1,364 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnsafeAtomic returned when output directories can not be replaced as a whole.
+var ErrUnsafeAtomic = errors.New("unsafe atomic generation")
+
+const stageSuffix = ".configen-"
+
+// stage is an OutputSink used for atomic generation. Files of the output directories are written into
+// staging directories (next to the output directories), prepopulated with hard links of the existing files.
+// On commit the staging directories replace the output directories. Files outside of the output
+// directories are replaced one by one, using temporary files.
+type stage struct {
+	mu        sync.Mutex
+	dirs      map[string]string // output directory -> staging directory
+	committed bool
+}
+
+// newStageFor returns a stage for the output directories of envs, unless generating in place is requested
+// (Options.NoAtomic) or output files are not written to the disk. Staging is the default for dedicated output
+// directories; if it is not possible, files are written in place, unless Options.Atomic requires staging.
+func newStageFor(opts *Options, envs []string) (*stage, error) {
+	if opts.NoAtomic || opts.Dry {
+		return nil, nil
+	}
+
+	if _, ok := opts.sink().(DirSink); !ok {
+		return nil, nil
+	}
+
+	dirs, err := outputDirs(opts, envs)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := newStage(dirs)
+	if errors.Is(err, ErrUnsafeAtomic) && !opts.Atomic {
+		return nil, nil
+	}
+
+	return st, err
+}
+
+func newStage(dirs []string) (*stage, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range dirs {
+		abs, err := filepath.Abs(a)
+		if err != nil {
+			return nil, err
+		}
+
+		if isInside(wd, abs) || abs == filepath.Dir(abs) {
+			return nil, fmt.Errorf("%w: %s is not a dedicated output directory", ErrUnsafeAtomic, a)
+		}
+
+		for _, b := range dirs {
+			if a != b && isInside(a, b) {
+				return nil, fmt.Errorf("%w: nested output directories %s, %s", ErrUnsafeAtomic, b, a)
+			}
+		}
+	}
+
+	s := &stage{dirs: make(map[string]string, len(dirs))}
+
+	for _, dir := range dirs {
+		parent := filepath.Dir(dir)
+
+		if err := os.MkdirAll(parent, dirPerm); err != nil {
+			s.cleanup()
+
+			return nil, err
+		}
+
+		tmp, err := ioutil.TempDir(parent, "."+filepath.Base(dir)+stageSuffix)
+		if err != nil {
+			s.cleanup()
+
+			return nil, err
+		}
+
+		s.dirs[dir] = tmp
+
+		if err := linkTree(dir, tmp); err != nil {
+			s.cleanup()
+
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// WriteFile writes files of the output directories into the staging directories until commit,
+// other files are replaced atomically.
+func (s *stage) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if staged, ok := s.staged(name); ok {
+		// the existing file may be a hard link of the original output file
+		if err := os.Remove(staged); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return DirSink{}.WriteFile(staged, data, perm)
+	}
+
+	return writeFileAtomic(name, data, perm)
+}
+
+func (s *stage) staged(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.committed {
+		return "", false
+	}
+
+	for dir, tmp := range s.dirs {
+		if isInside(name, dir) {
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return "", false
+			}
+
+			return filepath.Join(tmp, rel), true
+		}
+	}
+
+	return "", false
+}
+
+// commit replaces the output directories with the staging directories. If an output directory can not
+// be replaced, the ones already replaced are restored, so either every output directory is replaced or none.
+func (s *stage) commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirs := make([]string, 0, len(s.dirs))
+
+	for dir := range s.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+
+	swapped := make([]*swap, 0, len(dirs))
+
+	for _, dir := range dirs {
+		sw, err := swapDir(dir, s.dirs[dir])
+		if err != nil {
+			for i := len(swapped) - 1; i >= 0; i-- {
+				swapped[i].rollback()
+			}
+
+			return err
+		}
+
+		swapped = append(swapped, sw)
+	}
+
+	s.committed = true
+
+	var err error
+
+	for _, sw := range swapped {
+		delete(s.dirs, sw.dir)
+
+		if e := sw.finish(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// cleanup removes the staging directories not committed.
+func (s *stage) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for dir, tmp := range s.dirs {
+		os.RemoveAll(tmp) // nolint
+
+		delete(s.dirs, dir)
+	}
+}
+
+// swap is an output directory replaced by its staging directory. The original directory is kept
+// as backup (if it existed) until finish.
+type swap struct {
+	dir    string
+	tmp    string
+	backup string
+}
+
+func swapDir(dir, tmp string) (*swap, error) {
+	mode := fs.FileMode(dirPerm)
+
+	info, err := os.Stat(dir)
+	if err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// staging directories are created with 0700 permission
+	if err := os.Chmod(tmp, mode); err != nil {
+		return nil, err
+	}
+
+	sw := &swap{dir: dir, tmp: tmp}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		sw.backup = tmp + ".old"
+
+		if err := os.Rename(dir, sw.backup); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		if len(sw.backup) != 0 {
+			os.Rename(sw.backup, dir) // nolint
+		}
+
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+// rollback restores the original directory, the new one is moved back to the staging directory.
+func (sw *swap) rollback() {
+	os.Rename(sw.dir, sw.tmp) // nolint
+
+	if len(sw.backup) != 0 {
+		os.Rename(sw.backup, sw.dir) // nolint
+	}
+}
+
+// finish removes the backup of the original directory.
+func (sw *swap) finish() error {
+	if len(sw.backup) == 0 {
+		return nil
+	}
+
+	return os.RemoveAll(sw.backup)
+}
+
+// linkTree recreates the src directory tree in dst using hard links (or copies, if linking is not possible).
+func linkTree(src, dst string) error {
+	err := filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		default:
+			if os.Link(path, target) == nil {
+				return nil
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			return ioutil.WriteFile(target, b, info.Mode().Perm())
+		}
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func writeFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(name)
+
+	if err := mkdir(dir); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(name)+stageSuffix)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // nolint
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// isInside reports whether path is dir or is inside dir.
+func isInside(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
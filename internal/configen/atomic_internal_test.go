@@ -0,0 +1,75 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStage_commit_rollback(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	a, b := filepath.Join(out, "a"), filepath.Join(out, "b")
+
+	for _, dir := range []string{a, b} {
+		assert.Nil(t, os.MkdirAll(dir, 0o755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "file.txt"), []byte("old\n"), 0o600))
+	}
+
+	st, err := newStage([]string{a, b})
+
+	assert.Nil(t, err)
+
+	for _, dir := range []string{a, b} {
+		assert.Nil(t, st.WriteFile(filepath.Join(dir, "file.txt"), []byte("new\n"), 0o600))
+	}
+
+	// b can not be moved to its backup
+	backup := st.dirs[b] + ".old"
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(backup, "blocker"), 0o755))
+
+	assert.NotNil(t, st.commit())
+
+	for _, dir := range []string{a, b} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "file.txt"))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "old\n", string(data), dir)
+	}
+
+	assert.Nil(t, os.RemoveAll(backup))
+
+	st.cleanup()
+
+	entries, err := ioutil.ReadDir(out)
+
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,167 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_atomic(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	dir := filepath.Join(out, "dev")
+
+	assert.Nil(t, os.MkdirAll(dir, 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("old a\n"), 0o600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "keep.txt"), []byte("keep\n"), 0o600))
+
+	fsys := fstest.MapFS{
+		"templates/a.txt": {Data: []byte("new a\n")},
+		"templates/b.txt": {Data: []byte("{{ fail \"broken\" }}")},
+	}
+
+	opts := &configen.Options{ // nolint
+		FS:        fsys,
+		Templates: []string{"templates"},
+		Output:    filepath.Join(out, "{{.Env}}"),
+		Define:    map[string]string{},
+		Loose:     true,
+		Quiet:     true,
+		Atomic:    true,
+		KeepGoing: true,
+	}
+
+	_, err := configen.Render(opts, "dev")
+
+	assert.NotNil(t, err)
+	assertFile(t, filepath.Join(dir, "a.txt"), "old a\n")
+	assertFile(t, filepath.Join(dir, "keep.txt"), "keep\n")
+	assertNoFile(t, filepath.Join(dir, "b.txt"))
+	assertEntries(t, out, "dev")
+
+	fsys["templates/b.txt"] = &fstest.MapFile{Data: []byte("b\n")}
+
+	_, err = configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assertFile(t, filepath.Join(dir, "a.txt"), "new a\n")
+	assertFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	assertFile(t, filepath.Join(dir, "keep.txt"), "keep\n")
+	assertEntries(t, out, "dev")
+}
+
+func TestRender_atomic_unsafe(t *testing.T) {
+	t.Parallel()
+
+	opts := &configen.Options{ // nolint
+		FS:        fstest.MapFS{"templates/a.txt": {Data: []byte("a\n")}},
+		Templates: []string{"templates"},
+		Output:    ".",
+		Define:    map[string]string{},
+		Atomic:    true,
+	}
+
+	_, err := configen.Render(opts, "dev")
+
+	assert.True(t, errors.Is(err, configen.ErrUnsafeAtomic))
+}
+
+func assertFile(t *testing.T, name string, content string) {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(name)
+
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(b))
+}
+
+func assertNoFile(t *testing.T, name string) {
+	t.Helper()
+
+	_, err := os.Stat(name)
+
+	assert.True(t, os.IsNotExist(err))
+}
+
+func assertEntries(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	entries, err := ioutil.ReadDir(dir)
+
+	assert.Nil(t, err)
+
+	actual := make([]string, 0, len(entries))
+	for _, e := range entries {
+		actual = append(actual, e.Name())
+	}
+
+	assert.Equal(t, names, actual)
+}
+
+func TestRender_noAtomic(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	dir := filepath.Join(out, "dev")
+
+	assert.Nil(t, os.MkdirAll(dir, 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("old a\n"), 0o600))
+
+	fsys := fstest.MapFS{
+		"templates/a.txt": {Data: []byte("new a\n")},
+		"templates/b.txt": {Data: []byte("{{ fail \"broken\" }}")},
+	}
+
+	opts := &configen.Options{ // nolint
+		FS:        fsys,
+		Templates: []string{"templates"},
+		Output:    filepath.Join(out, "{{.Env}}"),
+		Define:    map[string]string{},
+		Loose:     true,
+		Quiet:     true,
+		KeepGoing: true,
+	}
+
+	// staged by default
+	_, err := configen.Render(opts, "dev")
+
+	assert.NotNil(t, err)
+	assertFile(t, filepath.Join(dir, "a.txt"), "old a\n")
+
+	opts.NoAtomic = true
+
+	_, err = configen.Render(opts, "dev")
+
+	assert.NotNil(t, err)
+	assertFile(t, filepath.Join(dir, "a.txt"), "new a\n")
+	assertEntries(t, out, "dev")
+}
@@ -0,0 +1,195 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DriftKind classifies the difference between an output file and its fresh render.
+type DriftKind string
+
+const (
+	// DriftChanged means the content of the output file differs from the fresh render.
+	DriftChanged DriftKind = "changed"
+	// DriftMissing means the file would be generated, but it is missing from the output directory.
+	DriftMissing DriftKind = "missing"
+	// DriftExtra means the file is in the output directory, but it would not be generated.
+	DriftExtra DriftKind = "extra"
+)
+
+// Drift describes a difference between the output directory and a fresh render.
+type Drift struct {
+	Kind DriftKind `json:"kind"`
+	Path string    `json:"path"`
+	Diff string    `json:"diff"` // unified diff from the existing file to the fresh render
+}
+
+// Check renders all environments into memory and compares the result with the files in the output directories:
+// the generated files, the copied raw files and the package descriptor. The returned drifts are sorted by path.
+// Console output of templates is suppressed.
+func Check(opts *Options, envs ...string) ([]*Drift, error) {
+	sink := NewMemorySink()
+
+	o := *opts
+
+	o.Sink = sink
+	o.Dry = false
+	o.Quiet = true
+
+	// every file is rendered, incremental generation would skip the unaffected ones
+	o.Since = ""
+	o.Previous = nil
+	o.Changed = nil
+
+	if _, err := Render(&o, envs...); err != nil {
+		return nil, err
+	}
+
+	rendered := sink.Files()
+	drifts := []*Drift{}
+
+	for _, name := range sink.Names() {
+		path := filepath.FromSlash(name)
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if err != nil {
+			drifts, err = appendDrift(drifts, DriftMissing, path, nil, rendered[name])
+		} else if !bytes.Equal(b, rendered[name]) {
+			drifts, err = appendDrift(drifts, DriftChanged, path, b, rendered[name])
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	extra, err := findExtra(opts, envs, rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range extra {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if drifts, err = appendDrift(drifts, DriftExtra, path, b, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool { return drifts[i].Path < drifts[j].Path })
+
+	return drifts, nil
+}
+
+func appendDrift(drifts []*Drift, kind DriftKind, path string, existing, fresh []byte) ([]*Drift, error) {
+	name := filepath.ToSlash(path)
+
+	diff, err := unifiedDiff(existing, fresh, "a/"+name, "b/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(drifts, &Drift{Kind: kind, Path: path, Diff: diff}), nil
+}
+
+// findExtra returns files of the output directories which are not in the rendered set.
+func findExtra(opts *Options, envs []string, rendered map[string][]byte) ([]string, error) {
+	dirs, err := outputDirs(opts, envs)
+	if err != nil {
+		return nil, err
+	}
+
+	extra := []string{}
+
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && path == dir {
+					return nil
+				}
+
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			if _, ok := rendered[filepath.ToSlash(path)]; ok {
+				return nil
+			}
+
+			extra = append(extra, path)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return extra, nil
+}
+
+// outputDirs returns the distinct output directories of the environments (and matrix dimensions).
+func outputDirs(opts *Options, envs []string) ([]string, error) {
+	all, err := targets(opts, envs)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+
+	for _, t := range all {
+		dir, err := t.resolve(opts.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		set[filepath.Clean(dir)] = true
+	}
+
+	dirs := make([]string, 0, len(set))
+
+	for dir := range set {
+		dirs = append(dirs, dir)
+	}
+
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/foo.txt": {Data: []byte("foo {{.Values.name}}\n")},
+			"templates/bar.txt": {Data: []byte("bar\n")},
+			"static/raw.txt":    {Data: []byte("raw\n")},
+		},
+		Templates: []string{"templates"},
+		Raws:      []string{"static"},
+		Output:    out,
+		Define:    map[string]string{"name": "demo"},
+	}
+
+	assert.Nil(t, configen.Generate(opts, ""))
+
+	drifts, err := configen.Check(opts, "")
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+
+	// files not affected by changes are compared too
+	incremental := *opts
+	incremental.Since = "HEAD"
+	incremental.Previous, err = configen.Render(opts, "")
+	incremental.Changed = []string{}
+
+	assert.Nil(t, err)
+
+	drifts, err = configen.Check(&incremental, "")
+
+	assert.Nil(t, err)
+	assert.Empty(t, drifts)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(out, "foo.txt"), []byte("foo old\n"), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(out, "stale.txt"), []byte("stale"), 0600))
+	assert.Nil(t, os.Remove(filepath.Join(out, "raw.txt")))
+
+	drifts, err = configen.Check(opts, "")
+
+	assert.Nil(t, err)
+	assert.Len(t, drifts, 3)
+
+	name := filepath.ToSlash(filepath.Join(out, "foo.txt"))
+
+	assert.Equal(t, configen.DriftChanged, drifts[0].Kind)
+	assert.Equal(t, "--- a/"+name+"\n+++ b/"+name+"\n@@ -1 +1 @@\n-foo old\n+foo demo\n", drifts[0].Diff)
+
+	assert.Equal(t, configen.DriftMissing, drifts[1].Kind)
+	assert.Equal(t, filepath.Join(out, "raw.txt"), drifts[1].Path)
+
+	assert.Equal(t, configen.DriftExtra, drifts[2].Kind)
+	assert.Contains(t, drifts[2].Diff, "-stale\n\\ No newline at end of file\n")
+}
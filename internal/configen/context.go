@@ -27,8 +27,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 
-	"github.com/imdario/mergo"
 	"github.com/pelletier/go-toml"
 	"gopkg.in/yaml.v3"
 	"muzzammil.xyz/jsonc"
@@ -103,6 +103,35 @@ func yamlUnmarshal(data []byte, v interface{}) error {
 	return json.Unmarshal(b, v)
 }
 
+// Parse parses data in the given format into a new Context.
+func Parse(data []byte, format string) (Context, error) {
+	c := Context{}
+
+	if err := c.unmarshal(data, format); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Format formats the Context in the given format.
+func (c Context) Format(format string) ([]byte, error) {
+	return c.marshal(format)
+}
+
+// Formats returns the sorted list of supported data formats.
+func Formats() []string {
+	all := make([]string, 0, len(parsers))
+
+	for format := range parsers {
+		all = append(all, format)
+	}
+
+	sort.Strings(all)
+
+	return all
+}
+
 func (c *Context) unmarshal(data []byte, format string) error {
 	fn, ok := parsers[format]
 	if !ok {
@@ -121,8 +150,53 @@ func (c Context) marshal(format string) ([]byte, error) {
 	return fn(c)
 }
 
+// merge merges other into the Context, keeping the existing values.
 func (c Context) merge(other Context) error {
-	return mergo.Merge(&c, other)
+	rules := &mergeRules{global: mergeRule{Strategy: MergeKeepFirst, Lists: ListsReplace, Nulls: NullsIgnore}}
+
+	m, _ := asMap(rules.merge(nil, c, other, false))
+
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return nil
+}
+
+// clone returns a deep copy of the Context. Maps and slices are copied, other values are shared.
+func (c Context) clone() Context {
+	return cloneValue(c).(Context)
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Context:
+		m := make(Context, len(val))
+
+		for k, e := range val {
+			m[k] = cloneValue(e)
+		}
+
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+
+		for k, e := range val {
+			m[k] = cloneValue(e)
+		}
+
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(val))
+
+		for i, e := range val {
+			a[i] = cloneValue(e)
+		}
+
+		return a
+	default:
+		return v
+	}
 }
 
 func (c Context) get(key string) (string, bool) {
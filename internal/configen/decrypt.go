@@ -0,0 +1,520 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNoDecryptionKey returned if an encrypted values file is found, but no age identity is given.
+	ErrNoDecryptionKey = errors.New("no decryption key (use --age-key, SOPS_AGE_KEY_FILE or SOPS_AGE_KEY)")
+
+	// ErrDecryption returned if an encrypted values file can not be decrypted.
+	ErrDecryption = errors.New("decryption failed")
+)
+
+const (
+	ageSuffix = ".age"
+	ageMagic  = "age-encryption.org/"
+
+	sopsKey = "sops"
+
+	envAgeKeyFile = "SOPS_AGE_KEY_FILE"
+	envAgeKey     = "SOPS_AGE_KEY"
+
+	// minRedacted is the minimal length of values redacted in dump files. Redaction replaces text,
+	// so a short value (like 1 or on) would be replaced everywhere it occurs, in keys and other values
+	// too, making the dump unreadable. Short values carry little secret anyway.
+	minRedacted = 4
+	redacted    = "[REDACTED]"
+)
+
+// sopsFormats are the formats of SOPS encrypted documents whose MAC can be verified (SOPS itself has no TOML support).
+var sopsFormats = map[string]bool{"yaml": true, "yml": true, "json": true, "jsonc": true}
+
+// encValue matches SOPS encrypted values.
+var encValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+// valuesFormatOf returns the format of a values file, which may be age encrypted (values.yaml.age).
+func valuesFormatOf(name string) string {
+	return formatOf(strings.TrimSuffix(name, ageSuffix))
+}
+
+// isAgeEncrypted reports whether b is an age encrypted file (armored or binary).
+func isAgeEncrypted(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte(armor.Header)) || bytes.HasPrefix(b, []byte(ageMagic))
+}
+
+// ageIdentities reads the age identities from Options.AgeKeyFile, the file named by SOPS_AGE_KEY_FILE
+// or the SOPS_AGE_KEY environment variable (the first one given).
+func ageIdentities(o *Options) ([]age.Identity, error) {
+	var src io.Reader
+
+	if file := o.AgeKeyFile; len(file) != 0 {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		src = bytes.NewReader(b)
+	} else if file := o.getenv(envAgeKeyFile); len(file) != 0 {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		src = bytes.NewReader(b)
+	} else if key := o.getenv(envAgeKey); len(key) != 0 {
+		src = strings.NewReader(key)
+	} else {
+		return nil, ErrNoDecryptionKey
+	}
+
+	return age.ParseIdentities(src)
+}
+
+// decryptAge decrypts an age encrypted file in memory.
+func decryptAge(b []byte, identities []age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(b)
+
+	if !bytes.HasPrefix(b, []byte(ageMagic)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(b)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, err)
+	}
+
+	plain, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, err)
+	}
+
+	return plain, nil
+}
+
+// isSOPS reports whether ctx is a SOPS encrypted document.
+func isSOPS(ctx Context) bool {
+	meta, ok := asMap(ctx[sopsKey])
+	if !ok {
+		return false
+	}
+
+	_, hasMAC := meta["mac"]
+
+	return hasMAC
+}
+
+// decryptSOPS decrypts the values of a SOPS encrypted document in place, using the data key encrypted
+// for an age recipient, and returns the decrypted values. The MAC of the document is verified on the raw
+// document b (the MAC depends on the order of keys and list items, which is lost by parsing).
+// The metadata is removed. Only yaml and json documents are supported.
+func decryptSOPS(ctx Context, b []byte, format string, identities []age.Identity) ([]interface{}, error) {
+	if !sopsFormats[format] {
+		return nil, fmt.Errorf("%w: SOPS encrypted %s files are not supported (use yaml or json)", ErrDecryption, format)
+	}
+
+	meta, _ := asMap(ctx[sopsKey])
+
+	recipients, _ := meta["age"].([]interface{})
+
+	var key []byte
+
+	for _, recipient := range recipients {
+		m, _ := asMap(recipient)
+
+		enc, _ := m["enc"].(string)
+		if len(enc) == 0 {
+			continue
+		}
+
+		if b, err := decryptAge([]byte(enc), identities); err == nil {
+			key = b
+
+			break
+		}
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("%w: no data key for the given age identities", ErrDecryption)
+	}
+
+	if err := verifySOPS(b, key); err != nil {
+		return nil, err
+	}
+
+	delete(ctx, sopsKey)
+
+	secrets := []interface{}{}
+
+	_, err := decryptTree(nil, ctx, key, &secrets)
+
+	return secrets, err
+}
+
+// decryptTree decrypts the encrypted values of the tree. The path (map keys, list items not included)
+// is the additional authenticated data of the values, like in SOPS.
+func decryptTree(path []string, value interface{}, key []byte, secrets *[]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case Context, map[string]interface{}:
+		m, _ := asMap(v)
+
+		for k, e := range m {
+			d, err := decryptTree(append(path[:len(path):len(path)], k), e, key, secrets)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = d
+		}
+
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			d, err := decryptTree(path, e, key, secrets)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = d
+		}
+
+		return v, nil
+	case string:
+		if !encValue.MatchString(v) {
+			return v, nil
+		}
+
+		d, err := decryptValue(v, key, strings.Join(path, ":")+":")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrDecryption, strings.Join(path, "."), err)
+		}
+
+		*secrets = append(*secrets, d)
+
+		return d, nil
+	default:
+		return v, nil
+	}
+}
+
+func decryptValue(value string, key []byte, aad string) (interface{}, error) {
+	plain, typ, err := decryptPlain(value, key, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	str := string(plain)
+
+	switch typ {
+	case "str", "bytes", "comment":
+		return str, nil
+	case "int", "float":
+		return strconv.ParseFloat(str, 64)
+	case "bool":
+		return strconv.ParseBool(str)
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+}
+
+// decryptPlain returns the plaintext and the type of an encrypted value.
+func decryptPlain(value string, key []byte, aad string) ([]byte, string, error) {
+	parts := encValue.FindStringSubmatch(value)
+	if parts == nil {
+		return nil, "", errors.New("malformed encrypted value")
+	}
+
+	var raw [3][]byte
+
+	for i := range raw {
+		b, err := base64.StdEncoding.DecodeString(parts[i+1])
+		if err != nil {
+			return nil, "", err
+		}
+
+		raw[i] = b
+	}
+
+	data, iv, tag := raw[0], raw[1], raw[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, "", err
+	}
+
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return plain, parts[4], nil
+}
+
+// verifySOPS verifies the MAC of a SOPS encrypted document (yaml or json). Like in SOPS, the MAC is
+// the SHA-512 hash of the (decrypted) values in document order, encrypted with the last modification
+// time as additional authenticated data. With mac_only_encrypted only the encrypted values are hashed.
+func verifySOPS(b []byte, key []byte) error {
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: not a SOPS document", ErrDecryption)
+	}
+
+	root := doc.Content[0]
+
+	meta := mappingValue(root, sopsKey)
+	mac := mappingValue(meta, "mac")
+	modified := mappingValue(meta, "lastmodified")
+	onlyEncrypted := mappingValue(meta, "mac_only_encrypted")
+
+	if mac == nil || modified == nil {
+		return fmt.Errorf("%w: missing MAC", ErrDecryption)
+	}
+
+	hash := sha512.New()
+	only := onlyEncrypted != nil && onlyEncrypted.Value == "true"
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if k := root.Content[i].Value; k != sopsKey {
+			if err := hashValues(hash, []string{k}, root.Content[i+1], key, only); err != nil {
+				return err
+			}
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339, modified.Value)
+	if err != nil {
+		return fmt.Errorf("%w: lastmodified: %s", ErrDecryption, err)
+	}
+
+	expected, _, err := decryptPlain(mac.Value, key, t.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("%w: MAC: %s", ErrDecryption, err)
+	}
+
+	if !strings.EqualFold(string(expected), fmt.Sprintf("%X", hash.Sum(nil))) {
+		return fmt.Errorf("%w: MAC mismatch, the file has been modified", ErrDecryption)
+	}
+
+	return nil
+}
+
+// hashValues adds the values of the node to the MAC in document order. Values are hashed
+// in the form SOPS uses (like True and False for booleans).
+func hashValues(hash io.Writer, path []string, node *yaml.Node, key []byte, onlyEncrypted bool) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			sub := append(path[:len(path):len(path)], node.Content[i].Value)
+
+			if err := hashValues(hash, sub, node.Content[i+1], key, onlyEncrypted); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := hashValues(hash, path, item, key, onlyEncrypted); err != nil {
+				return err
+			}
+		}
+	case yaml.AliasNode:
+		return hashValues(hash, path, node.Alias, key, onlyEncrypted)
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!str" && encValue.MatchString(node.Value) {
+			plain, typ, err := decryptPlain(node.Value, key, strings.Join(path, ":")+":")
+			if err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrDecryption, strings.Join(path, "."), err)
+			}
+
+			if typ != "comment" {
+				hash.Write(plain) // nolint
+			}
+
+			return nil
+		}
+
+		if !onlyEncrypted {
+			hash.Write(scalarBytes(node)) // nolint
+		}
+	}
+
+	return nil
+}
+
+// scalarBytes returns the value of an unencrypted scalar as hashed by SOPS.
+func scalarBytes(node *yaml.Node) []byte {
+	switch node.ShortTag() {
+	case "!!int":
+		var i int64
+		if node.Decode(&i) == nil {
+			return []byte(strconv.FormatInt(i, 10))
+		}
+	case "!!float":
+		var f float64
+		if node.Decode(&f) == nil {
+			return []byte(strconv.FormatFloat(f, 'f', -1, 64))
+		}
+	case "!!bool":
+		var v bool
+		if node.Decode(&v) == nil && v {
+			return []byte("True")
+		}
+
+		return []byte("False")
+	case "!!null":
+		return nil
+	}
+
+	return []byte(node.Value)
+}
+
+// mappingValue returns the value of key in the mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// scalars returns the scalar values of the tree.
+func scalars(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case Context, map[string]interface{}:
+		m, _ := asMap(v)
+		all := []interface{}{}
+
+		for _, e := range m {
+			all = append(all, scalars(e)...)
+		}
+
+		return all
+	case []interface{}:
+		all := []interface{}{}
+
+		for _, e := range v {
+			all = append(all, scalars(e)...)
+		}
+
+		return all
+	case nil:
+		return nil
+	default:
+		return []interface{}{v}
+	}
+}
+
+// redactor replaces values of encrypted sources and looked up secrets in dump files.
+type redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// add registers the string and number values for redaction, in the encoded forms of the
+// quote and toJson (escaped) and b64enc template functions too. Booleans are not redacted.
+func (r *redactor) add(values ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, value := range values {
+		if _, ok := value.(bool); ok {
+			continue
+		}
+
+		str := fmt.Sprint(value)
+		if len(str) < minRedacted {
+			continue
+		}
+
+		quoted := strconv.Quote(str)
+		escaped, _ := json.Marshal(str)
+
+		forms := []string{
+			str,
+			quoted[1 : len(quoted)-1],
+			string(escaped[1 : len(escaped)-1]),
+			base64.StdEncoding.EncodeToString([]byte(str)),
+		}
+
+		for i, form := range forms {
+			if i == 0 || form != str {
+				r.secrets = append(r.secrets, form)
+			}
+		}
+	}
+
+	// longer values first, so values containing other ones are redacted as a whole
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+func (r *redactor) redact(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		b = bytes.ReplaceAll(b, []byte(secret), []byte(redacted))
+	}
+
+	return b
+}
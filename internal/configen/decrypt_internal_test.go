@@ -0,0 +1,262 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+)
+
+func ageEncrypt(t *testing.T, recipient age.Recipient, plain []byte) string {
+	t.Helper()
+
+	var buff bytes.Buffer
+
+	aw := armor.NewWriter(&buff)
+
+	w, err := age.Encrypt(aw, recipient)
+	assert.Nil(t, err)
+
+	_, err = w.Write(plain)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	assert.Nil(t, aw.Close())
+
+	return buff.String()
+}
+
+func sopsEncrypt(t *testing.T, key []byte, value, typ, aad string) string {
+	t.Helper()
+
+	iv := make([]byte, 32)
+
+	_, err := io.ReadFull(rand.Reader, iv)
+	assert.Nil(t, err)
+
+	block, err := aes.NewCipher(key)
+	assert.Nil(t, err)
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	assert.Nil(t, err)
+
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(aad))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.StdEncoding.EncodeToString
+
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", enc(data), enc(iv), enc(tag), typ)
+}
+
+// sopsMAC returns the encrypted MAC of the plaintext values (in document order).
+func sopsMAC(t *testing.T, key []byte, modified string, values ...string) string {
+	t.Helper()
+
+	hash := sha512.New()
+
+	for _, value := range values {
+		hash.Write([]byte(value)) // nolint
+	}
+
+	return sopsEncrypt(t, key, fmt.Sprintf("%X", hash.Sum(nil)), "str", modified)
+}
+
+func TestGenerator_newContext_encrypted(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+
+	key := make([]byte, 32)
+
+	_, err = io.ReadFull(rand.Reader, key)
+	assert.Nil(t, err)
+
+	const modified = "2021-06-01T10:00:00Z"
+
+	password := sopsEncrypt(t, key, "s3cr3t-password", "str", "db:password:")
+	flag := sopsEncrypt(t, key, "true", "bool", "flags:")
+
+	sops := fmt.Sprintf(`{
+  "name": "app",
+  "db": {"password": %q, "port": %q, "user_unencrypted": "admin"},
+  "flags": [%q, "beta"],
+  "moved": %q,
+  "sops": {
+    "age": [{"recipient": %q, "enc": %q}],
+    "lastmodified": %q,
+    "mac": %q,
+    "version": "3.7.1"
+  }
+}`,
+		password,
+		sopsEncrypt(t, key, "5432", "int", "db:port:"),
+		flag,
+		sopsEncrypt(t, key, "moved", "str", "other:"),
+		identity.Recipient().String(),
+		ageEncrypt(t, identity.Recipient(), key),
+		modified,
+		sopsMAC(t, key, modified, "app", "s3cr3t-password", "5432", "admin", "true", "beta", "moved"),
+	)
+
+	fsys := fstest.MapFS{
+		"secrets.json":     {Data: []byte(sops)},
+		"secrets.yaml.age": {Data: []byte(ageEncrypt(t, identity.Recipient(), []byte("token: abcd-efgh\n")))},
+		"values.yaml":      {Data: []byte("name: plain\n")},
+	}
+
+	o := &Options{ // nolint
+		FS:      fsys,
+		Values:  []string{"secrets.json", "values.yaml"},
+		Environ: map[string]string{envAgeKey: identity.String()},
+	}
+
+	_, err = new(generator).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrDecryption), "value moved to another key")
+
+	fsys["secrets.json"].Data = bytes.Replace(fsys["secrets.json"].Data, []byte(`"moved"`), []byte(`"other"`), 1)
+
+	g := new(generator)
+
+	c, err := g.newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{
+		"name":  "app",
+		"db":    map[string]interface{}{"password": "s3cr3t-password", "port": 5432.0, "user_unencrypted": "admin"},
+		"flags": []interface{}{true, "beta"},
+		"other": "moved",
+	}, c["Values"])
+	assert.Equal(t, []byte("user: [REDACTED] port: [REDACTED] admin true"), g.redactor.redact([]byte("user: s3cr3t-password port: 5432 admin true")))
+
+	valid := fsys["secrets.json"].Data
+
+	for name, tamper := range map[string]func([]byte) []byte{
+		"removed key": func(b []byte) []byte {
+			return bytes.Replace(b, []byte(fmt.Sprintf(`"password": %q, `, password)), nil, 1)
+		},
+		"edited plain value": func(b []byte) []byte {
+			return bytes.Replace(b, []byte(`"admin"`), []byte(`"root"`), 1)
+		},
+		"reordered list": func(b []byte) []byte {
+			return bytes.Replace(b, []byte(fmt.Sprintf(`[%q, "beta"]`, flag)), []byte(fmt.Sprintf(`["beta", %q]`, flag)), 1)
+		},
+	} {
+		tampered := tamper(valid)
+
+		assert.NotEqual(t, valid, tampered, name)
+
+		fsys["secrets.json"] = &fstest.MapFile{Data: tampered}
+
+		_, err = new(generator).newContext("", o)
+
+		assert.True(t, errors.Is(err, ErrDecryption), name)
+	}
+
+	fsys["secrets.json"] = &fstest.MapFile{Data: valid}
+
+	o.Values = []string{"secrets.yaml.age"}
+
+	c, err = new(generator).newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"token": "abcd-efgh"}, c["Values"])
+
+	fsys["secrets.toml"] = &fstest.MapFile{Data: []byte(fmt.Sprintf(`name = "app"
+
+[sops]
+lastmodified = %q
+mac = %q
+
+[[sops.age]]
+enc = %q
+`, modified, sopsMAC(t, key, modified, "app"), ageEncrypt(t, identity.Recipient(), key)))}
+
+	o.Values = []string{"secrets.toml"}
+
+	_, err = new(generator).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrDecryption))
+	assert.Contains(t, err.Error(), "SOPS encrypted toml files are not supported")
+
+	o.Values = []string{"secrets.yaml.age"}
+	o.Environ = map[string]string{envAgeKey: "", envAgeKeyFile: ""}
+
+	_, err = new(generator).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrNoDecryptionKey))
+
+	other, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+
+	o.Environ = map[string]string{envAgeKey: other.String()}
+
+	_, err = new(generator).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrDecryption))
+}
+
+func TestRender_encryptedDump(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+
+	sink := NewMemorySink()
+
+	opts := &Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.txt": {Data: []byte("password: {{ .Values.password }} {{ quote .Values.password }} {{ b64enc .Values.password }}\n")},
+			"secrets.yaml.age":  {Data: []byte(ageEncrypt(t, identity.Recipient(), []byte("password: 'hun\"ter22'\n")))},
+		},
+		Templates: []string{"templates"},
+		Values:    []string{"secrets.yaml.age"},
+		Output:    "dist",
+		Environ:   map[string]string{envAgeKey: identity.String()},
+		Dump:      true,
+		Quiet:     true,
+		Sink:      sink,
+	}
+
+	_, err = Render(opts, "")
+
+	assert.Nil(t, err)
+
+	files := sink.Files()
+
+	assert.Equal(t, "password: hun\"ter22 \"hun\\\"ter22\" aHVuInRlcjIy\n", string(files["dist/app.txt"]))
+	assert.Equal(t, "password: [REDACTED] \"[REDACTED]\" [REDACTED]\n", string(files["dist/app.txt~"]))
+}
@@ -24,20 +24,22 @@ package configen
 
 import (
 	"bytes"
-	"os"
+	"io"
 	"text/template"
 )
 
 type deferrer struct {
 	quiet    bool
+	out      io.Writer
 	context  Context
 	template *template.Template
 	deferred []string
 }
 
-func newDeferrer(quiet bool, t *template.Template, ctx Context) *deferrer {
+func newDeferrer(quiet bool, out io.Writer, t *template.Template, ctx Context) *deferrer {
 	d := &deferrer{
 		quiet:    quiet,
+		out:      out,
 		context:  ctx,
 		template: t,
 		deferred: []string{},
@@ -61,17 +63,23 @@ func (d *deferrer) render(document interface{}) error {
 		return nil
 	}
 
-	d.context["Document"] = document
+	ctx := make(Context, len(d.context)+1)
+
+	for k, v := range d.context {
+		ctx[k] = v
+	}
+
+	ctx["Document"] = document
 
 	for _, name := range d.deferred {
 		var buff bytes.Buffer
 
-		if err := d.template.ExecuteTemplate(&buff, name, d.context); err != nil {
+		if err := d.template.ExecuteTemplate(&buff, name, ctx); err != nil {
 			return err
 		}
 
 		if !d.quiet {
-			if _, err := os.Stdout.Write(buff.Bytes()); err != nil {
+			if _, err := d.out.Write(buff.Bytes()); err != nil {
 				return err
 			}
 		}
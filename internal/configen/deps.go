@@ -0,0 +1,133 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// depend records input files the outputs of the job depend on.
+func (j *job) depend(paths ...string) {
+	if j.deps == nil {
+		j.deps = make(map[string]bool)
+	}
+
+	for _, p := range paths {
+		j.deps[filepath.Clean(p)] = true
+	}
+}
+
+// dependVolatile records that the outputs of the job depend on inputs not tracked as files
+// (environment variables, secrets), so incremental generation always regenerates them.
+func (j *job) dependVolatile() {
+	if j != nil {
+		j.volatile = true
+	}
+}
+
+// dependencies returns the sorted list of recorded input files.
+func (j *job) dependencies() []string {
+	deps := make([]string, 0, len(j.deps))
+
+	for dep := range j.deps {
+		deps = append(deps, dep)
+	}
+
+	sort.Strings(deps)
+
+	return deps
+}
+
+// dependTemplate records the partial files defining the named template
+// and the templates invoked by it (transitively).
+func (g *generator) dependTemplate(j *job, t *template.Template, name string) {
+	seen := make(map[string]bool)
+
+	var visit func(name string)
+
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+
+		seen[name] = true
+
+		tmpl := t.Lookup(name)
+		if tmpl == nil || tmpl.Tree == nil {
+			return
+		}
+
+		if file, ok := g.partials[tmpl.Tree.ParseName]; ok {
+			j.depend(file)
+		}
+
+		walkTemplateRefs(tmpl.Tree.Root, visit)
+	}
+
+	visit(name)
+}
+
+// dependSchema records the schema file of the given schema reference, if it is a local file.
+func (g *generator) dependSchema(j *job, schema string) {
+	if file, ok := g.schemas[schema]; ok {
+		j.depend(file)
+
+		return
+	}
+
+	if u, err := url.Parse(schema); err == nil && u.Scheme == "" && len(u.Path) != 0 {
+		j.depend(filepath.FromSlash(path.Clean(u.Path)))
+	}
+}
+
+// walkTemplateRefs calls fn with the name of every template invoked by a template action under node.
+func walkTemplateRefs(node parse.Node, fn func(name string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, child := range n.Nodes {
+			walkTemplateRefs(child, fn)
+		}
+	case *parse.IfNode:
+		walkBranchRefs(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranchRefs(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranchRefs(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		fn(n.Name)
+	}
+}
+
+func walkBranchRefs(n *parse.BranchNode, fn func(name string)) {
+	walkTemplateRefs(n.List, fn)
+	walkTemplateRefs(n.ElseList, fn)
+}
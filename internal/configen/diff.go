@@ -0,0 +1,403 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffKind classifies the difference of a file or a value between two environments.
+type DiffKind string
+
+const (
+	// DiffAdded means the file or value exists only in the second environment.
+	DiffAdded DiffKind = "added"
+	// DiffRemoved means the file or value exists only in the first environment.
+	DiffRemoved DiffKind = "removed"
+	// DiffChanged means the file or value differs between the environments.
+	DiffChanged DiffKind = "changed"
+)
+
+// FileDiff describes the difference of an output file between two environments.
+type FileDiff struct {
+	Kind    DiffKind  `json:"kind"`
+	Path    string    `json:"path"`              // path relative to the output directory
+	Changes []*Change `json:"changes,omitempty"` // changed keys of data files, empty for text files
+	Diff    string    `json:"diff"`              // human readable (semantic or unified) diff
+}
+
+// Change describes the difference of a single value of a data file between two environments.
+type Change struct {
+	Kind DiffKind    `json:"kind"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Diff renders the a and b environments into memory and compares the output files having the same path
+// relative to the output directory of the environment. Files in data formats (yaml, json, toml) are compared
+// key by key, other files line by line. The package descriptor is not rendered. The returned differences
+// are sorted by path.
+func Diff(opts *Options, a, b string) ([]*FileDiff, error) {
+	left, err := renderRelative(opts, a)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := renderRelative(opts, b)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+
+	for name := range left {
+		names[name] = true
+	}
+
+	for name := range right {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+
+	sort.Strings(sorted)
+
+	diffs := []*FileDiff{}
+
+	for _, name := range sorted {
+		diff, err := diffFile(name, left[name], right[name], "@"+a, "@"+b)
+		if err != nil {
+			return nil, err
+		}
+
+		if diff != nil {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// renderRelative renders env into memory and returns the output files keyed by slash separated
+// path relative to the output directory of env. With matrix dimensions the paths are prefixed
+// by the dimension values, like "region=eu,tenant=a/".
+func renderRelative(opts *Options, env string) (map[string][]byte, error) {
+	sink := NewMemorySink()
+
+	o := *opts
+
+	o.Sink = sink
+	o.Dry = false
+	o.Dump = false
+	o.Quiet = true
+	o.Package = ""
+	o.Manifest = ""
+	o.Prune = false
+	o.Since = ""
+	o.Previous = nil
+	o.Changed = nil
+
+	report, err := Render(&o, env)
+	if err != nil {
+		return nil, err
+	}
+
+	data := sink.Files()
+	files := make(map[string][]byte)
+
+	for _, file := range report.Files {
+		dir, err := (target{env: file.Env, dims: file.Dims}).resolve(opts.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err := filepath.Rel(dir, file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.ToSlash(rel)
+
+		if len(file.Dims) != 0 {
+			name = dimsKey(file.Dims) + "/" + name
+		}
+
+		files[name] = data[filepath.ToSlash(file.Path)]
+	}
+
+	return files, nil
+}
+
+func diffFile(name string, a, b []byte, aLabel, bLabel string) (*FileDiff, error) {
+	diff := &FileDiff{Path: name}
+
+	switch {
+	case a == nil:
+		diff.Kind = DiffAdded
+	case b == nil:
+		diff.Kind = DiffRemoved
+	case bytes.Equal(a, b):
+		return nil, nil
+	default:
+		diff.Kind = DiffChanged
+	}
+
+	from, to := "a/"+name+" ("+aLabel+")", "b/"+name+" ("+bLabel+")"
+
+	if changes, ok := semanticDiff(a, b, formatOf(name)); ok {
+		if len(changes) == 0 {
+			return nil, nil
+		}
+
+		diff.Changes = changes
+		diff.Diff = formatChanges(changes, from, to)
+
+		return diff, nil
+	}
+
+	text, err := unifiedDiff(a, b, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff.Diff = text
+
+	return diff, nil
+}
+
+// semanticDiff compares a and b key by key if they are parsable in format.
+// Missing files are treated as empty documents.
+func semanticDiff(a, b []byte, format string) ([]*Change, bool) {
+	parser, ok := parsers[format]
+	if !ok {
+		return nil, false
+	}
+
+	left, right := Context{}, Context{}
+
+	if a != nil {
+		if err := parser(a, &left); err != nil {
+			return nil, false
+		}
+	}
+
+	if b != nil {
+		if err := parser(b, &right); err != nil {
+			return nil, false
+		}
+	}
+
+	changes := []*Change{}
+
+	compareValues("", map[string]interface{}(left), map[string]interface{}(right), &changes)
+
+	return changes, true
+}
+
+func compareValues(path string, a, b interface{}, changes *[]*Change) {
+	if am, ok := asMap(a); ok {
+		if bm, ok := asMap(b); ok {
+			compareMaps(path, am, bm, changes)
+
+			return
+		}
+	}
+
+	if aa, ok := a.([]interface{}); ok {
+		if ba, ok := b.([]interface{}); ok {
+			compareSlices(path, aa, ba, changes)
+
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, &Change{Kind: DiffChanged, Path: path, Old: a, New: b})
+	}
+}
+
+func compareMaps(path string, a, b map[string]interface{}, changes *[]*Change) {
+	keys := make([]string, 0, len(a)+len(b))
+
+	for k := range a {
+		keys = append(keys, k)
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		av, aok := a[k]
+		bv, bok := b[k]
+		sub := keyPath(path, k)
+
+		switch {
+		case !aok:
+			*changes = append(*changes, &Change{Kind: DiffAdded, Path: sub, New: bv})
+		case !bok:
+			*changes = append(*changes, &Change{Kind: DiffRemoved, Path: sub, Old: av})
+		default:
+			compareValues(sub, av, bv, changes)
+		}
+	}
+}
+
+func compareSlices(path string, a, b []interface{}, changes *[]*Change) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		sub := fmt.Sprintf("%s[%d]", path, i)
+
+		switch {
+		case i >= len(a):
+			*changes = append(*changes, &Change{Kind: DiffAdded, Path: sub, New: b[i]})
+		case i >= len(b):
+			*changes = append(*changes, &Change{Kind: DiffRemoved, Path: sub, Old: a[i]})
+		default:
+			compareValues(sub, a[i], b[i], changes)
+		}
+	}
+}
+
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case Context:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+var plainKey = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+func keyPath(path, key string) string {
+	if !plainKey.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	if len(path) == 0 {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func formatChanges(changes []*Change, from, to string) string {
+	var buff strings.Builder
+
+	fmt.Fprintf(&buff, "--- %s\n+++ %s\n", from, to)
+
+	for _, c := range changes {
+		switch c.Kind {
+		case DiffAdded:
+			fmt.Fprintf(&buff, "+ %s: %s\n", c.Path, formatValue(c.New))
+		case DiffRemoved:
+			fmt.Fprintf(&buff, "- %s: %s\n", c.Path, formatValue(c.Old))
+		case DiffChanged:
+			fmt.Fprintf(&buff, "~ %s: %s -> %s\n", c.Path, formatValue(c.Old), formatValue(c.New))
+		}
+	}
+
+	return buff.String()
+}
+
+func formatValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return string(b)
+}
+
+const (
+	devNull      = "/dev/null"
+	diffContext  = 3
+	binarySample = 8000
+)
+
+// unifiedDiff returns the unified diff of a and b. Missing sides are denoted by nil.
+func unifiedDiff(a, b []byte, from, to string) (string, error) {
+	if a == nil {
+		from = devNull
+	}
+
+	if b == nil {
+		to = devNull
+	}
+
+	if isBinary(a) || isBinary(b) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", from, to), nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(a),
+		B:        splitLines(b),
+		FromFile: from,
+		ToFile:   to,
+		Context:  diffContext,
+	})
+}
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+
+	last := len(lines) - 1
+
+	if len(lines[last]) == 0 {
+		return lines[:last]
+	}
+
+	// the missing newline at the end is a difference too
+	lines[last] += "\n\\ No newline at end of file\n"
+
+	return lines
+}
+
+func isBinary(b []byte) bool {
+	if len(b) > binarySample {
+		b = b[:binarySample]
+	}
+
+	return bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b)
+}
@@ -0,0 +1,89 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.yaml": {Data: []byte(`
+name: app
+replicas: {{ if eq .Env "prod" }}3{{ else }}1{{ end }}
+{{- if eq .Env "dev" }}
+debug: true
+{{- end }}
+hosts: [{{ .Env }}.example.com]
+`)},
+			"templates/notes.txt": {Data: []byte("environment: {{ .Env }}\n")},
+			"templates/same.txt":  {Data: []byte("same\n")},
+			"templates/file.txt":  {Data: []byte(`{{ if eq .Env "prod" }}{{ $_ := file "prod.txt" "prod" }}{{ end }}`)},
+		},
+		Templates: []string{"templates"},
+		Output:    "dist/{{.Env}}",
+		Define:    map[string]string{},
+	}
+
+	diffs, err := configen.Diff(opts, "dev", "prod")
+
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 3)
+
+	assert.Equal(t, "app.yaml", diffs[0].Path)
+	assert.Equal(t, configen.DiffChanged, diffs[0].Kind)
+	assert.Equal(t, `--- a/app.yaml (@dev)
++++ b/app.yaml (@prod)
+- debug: true
+~ hosts[0]: "dev.example.com" -> "prod.example.com"
+~ replicas: 1 -> 3
+`, diffs[0].Diff)
+	assert.Len(t, diffs[0].Changes, 3)
+
+	assert.Equal(t, "notes.txt", diffs[1].Path)
+	assert.Equal(t, `--- a/notes.txt (@dev)
++++ b/notes.txt (@prod)
+@@ -1 +1 @@
+-environment: dev
++environment: prod
+`, diffs[1].Diff)
+
+	assert.Equal(t, "prod.txt", diffs[2].Path)
+	assert.Equal(t, configen.DiffAdded, diffs[2].Kind)
+
+	// incremental options are ignored, every file is rendered
+	incremental := *opts
+	incremental.Since = "HEAD"
+
+	diffs, err = configen.Diff(&incremental, "dev", "prod")
+
+	assert.Nil(t, err)
+	assert.Len(t, diffs, 3)
+}
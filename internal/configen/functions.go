@@ -25,7 +25,7 @@ package configen
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"reflect"
 	"strings"
 	"text/template"
@@ -145,10 +145,21 @@ func newFuncMap() template.FuncMap {
 	return funcs
 }
 
-type files struct{}
+type files struct {
+	fsys fs.FS
+	read func(name string) // called with the name of every file read (if not nil)
+}
+
+func (f *files) fs() fs.FS {
+	if f.fsys != nil {
+		return f.fsys
+	}
+
+	return osFS{}
+}
 
 func (f *files) Get(name string) (string, error) {
-	b, err := ioutil.ReadFile(name)
+	b, err := f.GetBytes(name)
 	if err != nil {
 		return "", err
 	}
@@ -157,7 +168,11 @@ func (f *files) Get(name string) (string, error) {
 }
 
 func (f *files) GetBytes(name string) ([]byte, error) {
-	b, err := ioutil.ReadFile(name)
+	if f.read != nil {
+		f.read(name)
+	}
+
+	b, err := fs.ReadFile(f.fs(), name)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +25,8 @@ package configen
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,67 +39,184 @@ import (
 
 // Generate is the main entry point, called after parsing command line.
 func Generate(opts *Options, envs ...string) error {
-	dirs := make([]string, len(envs)+1)
+	_, err := Render(opts, envs...)
+
+	return err
+}
+
+// Render generates output files for all environments and returns the report of the run.
+// When opts.KeepGoing is set, the generation continues after errors and the returned
+// error is the first failure. Unless opts.NoAtomic is set, dedicated output directories are
+// replaced only if every file has been generated successfully.
+func Render(opts *Options, envs ...string) (*Report, error) {
+	report := new(Report)
+
+	st, err := newStageFor(opts, envs)
+	if err != nil {
+		return report, err
+	}
+
+	if st != nil {
+		defer st.cleanup()
+
+		o := *opts
+		o.Sink = st
+		opts = &o
+	}
+
+	all, err := targets(opts, envs)
+	if err != nil {
+		return report, err
+	}
+
+	if err := checkOutputs(all, opts.Output); err != nil {
+		return report, err
+	}
+
+	secrets, closer, err := newSecretsFor(opts)
+	if err != nil {
+		return report, err
+	}
+
+	defer closer()
+
+	sources := newSourceCache()
+
+	dirs := make([]string, len(all)+1)
+	gens := make([]*generator, len(all))
 
 	dirs[0] = opts.Output
 
-	for i, env := range envs {
-		g, err := newGenerator(env, opts)
+	for i, t := range all {
+		g, err := newGenerator(t, opts, secrets, sources)
 		if err != nil {
-			return err
+			return report, err
 		}
 
-		if err := g.generate(); err != nil {
-			return err
+		gens[i] = g
+		dirs[1+i] = g.output
+	}
+
+	graph, err := newIncremental(opts, longestcommon.Prefix(dirs))
+	if err != nil {
+		return report, err
+	}
+
+	jobs := []*job{}
+
+	for _, g := range gens {
+		all, err := g.jobs()
+		if err != nil {
+			return report, err
 		}
 
-		if err := g.copy(); err != nil {
-			return err
+		if graph != nil {
+			all = graph.filter(target{env: g.env, dims: g.dims}, g.digest, all)
 		}
 
-		dirs[1+i] = g.output
+		jobs = append(jobs, all...)
+	}
+
+	if err := runJobs(jobs, opts.Jobs, opts.KeepGoing, opts.stdout(), report); err != nil {
+		return report, err
+	}
+
+	if st != nil {
+		if err := st.commit(); err != nil {
+			return report, err
+		}
 	}
 
 	if !opts.Dry && len(opts.Package) > 0 {
-		return preparePackage(longestcommon.Prefix(dirs), opts.Package)
+		if err := preparePackage(report, opts, longestcommon.Prefix(dirs)); err != nil {
+			return report, err
+		}
 	}
 
-	return nil
-}
+	if !opts.Dry && len(opts.Manifest) > 0 {
+		if err := writeManifest(report, opts, longestcommon.Prefix(dirs)); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.Prune {
+		pruned, err := prune(report, opts, envs)
 
-func preparePackage(dir string, file string) error {
-	mkdir(dir) // nolint
+		report.Pruned = pruned
 
-	b, err := ioutil.ReadFile(file)
+		return report, err
+	}
+
+	return report, nil
+}
+
+func preparePackage(report *Report, opts *Options, dir string) error {
+	b, err := fs.ReadFile(opts.fsys(), opts.Package)
 	if err != nil {
 		return err
 	}
 
-	out := filepath.Join(dir, filepath.Base(file))
+	out := filepath.Join(dir, filepath.Base(opts.Package))
 
-	return ioutil.WriteFile(out, b, filePerm)
+	file := &FileReport{Source: opts.Package, Path: out, Format: formatOf(out)}
+
+	file.digest(b)
+	report.add(file)
+
+	return opts.sink().WriteFile(out, b, filePerm)
 }
 
 type generator struct {
-	templates []string
-	raws      []string
+	env       string
+	dims      map[string]string // values of matrix dimensions
+	chain     []string          // inheritance chain of env, the root ancestor first
+	templates [][]string        // template directory layers per template directory, the most specific first
+	raws      [][]string        // raw directory layers per raw directory, the most specific first
 	output    string
 	loaders   schemaLoaders
 	dump      bool
 	loose     bool
 	dry       bool
 	quiet     bool
+	stderr    io.Writer
+	environ   map[string]string
 	ctx       Context
 	root      *template.Template
+	fsys      fs.FS
+	sink      OutputSink
+	values    []string          // values files
+	redactor  *redactor         // values of encrypted values files and secrets, redacted in dump files
+	secrets   *secrets          // secret lookups shared by the generators of a run
+	sources   *sourceCache      // values of sources shared by the generators of a run
+	partials  map[string]string // partial template files by name
+	schemas   map[string]string // schema files by $id
+	digest    string            // digest of the values and options, see inputsDigest
 }
 
-func newGenerator(env string, o *Options) (g *generator, err error) {
+func newGenerator(t target, o *Options, s *secrets, sources *sourceCache) (g *generator, err error) {
 	g = new(generator)
 
+	env := t.env
+
+	g.env = env
+	g.dims = t.dims
 	g.dump = o.Dump
 	g.loose = o.Loose
 	g.dry = o.Dry
 	g.quiet = o.Quiet
+	g.stderr = &syncWriter{w: o.stderr()}
+	g.environ = o.Environ
+	g.fsys = o.fsys()
+	g.sink = o.sink()
+	g.redactor = new(redactor)
+	g.secrets = s
+	g.sources = sources
+	g.partials = make(map[string]string)
+	g.schemas = make(map[string]string)
+
+	if g.chain, err = envChain(env, o.Inherit); err != nil {
+		return nil, err
+	}
 
 	if g.root, err = g.newRootTemplate(env, o); err != nil {
 		return nil, err
@@ -112,54 +230,66 @@ func newGenerator(env string, o *Options) (g *generator, err error) {
 		return nil, err
 	}
 
-	if g.output, err = resolve(env, o.Output); err != nil {
+	if g.digest, err = inputsDigest(g.ctx, o); err != nil {
+		return nil, err
+	}
+
+	if g.output, err = t.resolve(o.Output); err != nil {
 		return nil, err
 	}
 
-	if g.templates, err = resolveAll(env, o.Templates); err != nil {
+	if g.templates, err = layered(g.fsys, g.chain, g.dims, o.Templates); err != nil {
 		return nil, err
 	}
 
-	if g.raws, err = resolveAll(env, o.Raws); err != nil {
+	if g.raws, err = layered(g.fsys, g.chain, g.dims, o.Raws); err != nil {
 		return nil, err
 	}
 
 	return g, nil
 }
 
-func (g *generator) generate() error {
-	for _, dir := range g.templates {
-		dir := dir
-		err := filepath.Walk(dir,
-			func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
+// jobs returns the jobs of generating the template files and copying the raw files.
+func (g *generator) jobs() ([]*job, error) {
+	jobs := []*job{}
 
-				if info.IsDir() || partialGlobe.Match(path) {
-					return nil
-				}
+	for _, layers := range g.templates {
+		err := walkLayers(g.fsys, layers, func(dir, rel string, entry fs.DirEntry) error {
+			path := filepath.Join(dir, rel)
 
-				rel, err := filepath.Rel(dir, path)
-				if err != nil {
-					return err
-				}
+			if partialGlobe.Match(path) {
+				return nil
+			}
 
-				return g.generateFile(dir, rel)
+			j := newJob(func(j *job) error {
+				return g.generateFile(j, dir, rel)
 			})
-		// nolint
+
+			j.source = path
+			jobs = append(jobs, j)
+
+			return nil
+		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	if len(g.raws) != 0 {
+		jobs = append(jobs, newJob(g.copy))
+	}
+
+	return jobs, nil
 }
 
-func (g *generator) templateFuncMap(t *template.Template) template.FuncMap {
-	funcs := g.newFuncMap()
+func (g *generator) templateFuncMap(t *template.Template, j *job, src string, data Context) template.FuncMap {
+	funcs := g.newFuncMap(j, src)
 
 	funcs["include"] = func(name string, data interface{}) (string, error) {
+		if j != nil {
+			g.dependTemplate(j, t, name)
+		}
+
 		var buf strings.Builder
 		err := t.ExecuteTemplate(&buf, name, data)
 
@@ -174,7 +304,7 @@ func (g *generator) templateFuncMap(t *template.Template) template.FuncMap {
 
 		sub := ctx
 
-		if err := sub.merge(g.ctx); err != nil {
+		if err := sub.merge(data); err != nil {
 			return "", err
 		}
 
@@ -190,13 +320,28 @@ func (g *generator) templateFuncMap(t *template.Template) template.FuncMap {
 	return funcs
 }
 
-func (g *generator) newFuncMap() template.FuncMap {
+func (g *generator) newFuncMap(j *job, src string) template.FuncMap {
 	funcs := newFuncMap()
 
+	funcs["env"] = func(key string) string {
+		j.dependVolatile()
+
+		return g.getenv(key)
+	}
+	funcs["expandenv"] = func(s string) string {
+		j.dependVolatile()
+
+		return os.Expand(s, g.getenv)
+	}
+
 	funcs["validate"] = func(schema string, v map[string]interface{}) bool {
+		if j != nil {
+			g.dependSchema(j, schema)
+		}
+
 		err := g.validate(schema, v)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(g.stderr, err)
 
 			return false
 		}
@@ -204,18 +349,25 @@ func (g *generator) newFuncMap() template.FuncMap {
 		return true
 	}
 
+	funcs["secret"] = func(ref string) (interface{}, error) {
+		j.dependVolatile()
+
+		return g.secrets.lookup(g, src, ref)
+	}
+
 	funcs["file"] = func(path string, content string) error {
-		clean := filepath.Clean(path)
+		out := filepath.Join(g.output, filepath.Clean(path))
 
-		dir := filepath.Join(g.output, filepath.Dir(clean))
+		file := &FileReport{Env: g.env, Dims: g.dims, Source: src, Path: out, Format: formatOf(out)}
 
-		if err := os.MkdirAll(dir, dirPerm); err != nil {
-			return err
-		}
+		file.digest([]byte(content))
+		j.report.add(file)
 
-		file := filepath.Join(dir, filepath.Base(clean))
+		if g.dry {
+			return nil
+		}
 
-		return ioutil.WriteFile(file, []byte(content), filePerm)
+		return g.sink.WriteFile(out, []byte(content), filePerm)
 	}
 
 	if g.quiet {
@@ -227,20 +379,28 @@ func (g *generator) newFuncMap() template.FuncMap {
 		funcs["outf"] = noop
 	} else {
 		funcs["out"] = func(a ...interface{}) (int, error) {
-			return fmt.Fprint(os.Stdout, a...) // nolint
+			return fmt.Fprint(&j.console, a...) // nolint
 		}
 		funcs["outln"] = func(a ...interface{}) (int, error) {
-			return fmt.Fprintln(os.Stdout, a...) // nolint
+			return fmt.Fprintln(&j.console, a...) // nolint
 		}
 		funcs["outf"] = func(format string, a ...interface{}) (int, error) {
-			return fmt.Fprintf(os.Stdout, format, a...) // nolint
+			return fmt.Fprintf(&j.console, format, a...) // nolint
 		}
 	}
 
 	return funcs
 }
 
-func (g *generator) executeTemplate(basedir string, path string) ([]byte, *deferrer, error) {
+func (g *generator) getenv(key string) string {
+	if val, ok := g.environ[key]; ok {
+		return val
+	}
+
+	return os.Getenv(key)
+}
+
+func (g *generator) executeTemplate(j *job, basedir string, path string) ([]byte, *deferrer, error) {
 	src := filepath.Join(basedir, path)
 
 	t, err := g.root.Clone()
@@ -248,16 +408,22 @@ func (g *generator) executeTemplate(basedir string, path string) ([]byte, *defer
 		return nil, nil, wrap(err, src)
 	}
 
-	t.Funcs(g.templateFuncMap(t))
+	// every template works on its own copy of the context, so templates can not affect each other
+	ctx := g.ctx.clone()
+
+	ctx["Files"] = &files{fsys: g.fsys, read: func(name string) { j.depend(name) }}
+
+	t.Funcs(g.templateFuncMap(t, j, src, ctx))
 
-	ctx := g.ctx
-	def := newDeferrer(g.quiet, t, g.ctx)
+	def := newDeferrer(g.quiet, &j.console, t, ctx)
 
-	t, err = t.ParseFiles(src)
+	t, err = g.parseFile(t, src)
 	if err != nil {
 		return nil, nil, wrap(err, src)
 	}
 
+	g.dependTemplate(j, t, filepath.Base(src))
+
 	var buff bytes.Buffer
 
 	err = t.ExecuteTemplate(&buff, filepath.Base(src), ctx)
@@ -270,13 +436,7 @@ func (g *generator) executeTemplate(basedir string, path string) ([]byte, *defer
 	if g.dump {
 		dump := filepath.Join(g.output, path) + dumpSuffix
 
-		dir := filepath.Dir(dump)
-
-		if err := mkdir(dir); err != nil {
-			return nil, nil, wrap(err, dir)
-		}
-
-		if err := ioutil.WriteFile(dump, txt, filePerm); err != nil {
+		if err := g.sink.WriteFile(dump, g.redactor.redact(txt), filePerm); err != nil {
 			return nil, nil, wrap(err, dump)
 		}
 	}
@@ -284,37 +444,63 @@ func (g *generator) executeTemplate(basedir string, path string) ([]byte, *defer
 	return txt, def, nil
 }
 
-func (g *generator) generateFile(basedir string, path string) error {
-	txt, console, err := g.executeTemplate(basedir, path)
+func (g *generator) generateFile(j *job, basedir string, path string) error {
+	file := &FileReport{Env: g.env, Dims: g.dims, Source: filepath.Join(basedir, path)}
+
+	j.depend(file.Source)
+	j.depend(g.values...)
+
+	file.Err = g.generateFileReport(j, basedir, path, file)
+
+	j.report.add(file)
+
+	deps := j.dependencies()
+
+	// outputs written by the file function depend on the same inputs
+	for _, f := range j.report.Files {
+		f.Deps = deps
+		f.Digest = g.digest
+		f.Volatile = j.volatile
+	}
+
+	return file.Err
+}
+
+func (g *generator) generateFileReport(j *job, basedir string, path string, file *FileReport) error {
+	txt, console, err := g.executeTemplate(j, basedir, path)
 	if err != nil {
 		return err
 	}
 
 	out := filepath.Join(g.output, path)
 
-	errfile := filepath.Join(basedir, path)
-
 	if g.dump {
-		errfile = out + dumpSuffix
+		file.Dump = out + dumpSuffix
 	}
 
-	if !g.dry {
-		dir := filepath.Dir(out)
+	errfile := filepath.Join(basedir, path)
 
-		if err := mkdir(dir); err != nil {
-			return wrap(err, dir)
-		}
+	if g.dump {
+		errfile = out + dumpSuffix
 	}
 
-	format := strings.TrimPrefix(filepath.Ext(out), ".")
+	format := formatOf(out)
 
-	txt, format, err = transform(txt, format)
+	txt, format, file.Schema, err = transform(txt, format)
 	if err != nil {
 		return wrap(err, errfile)
 	}
 
 	out = outname(out, format)
 
+	if len(file.Schema) != 0 {
+		g.dependSchema(j, file.Schema)
+	}
+
+	file.Path = out
+	file.Format = format
+	file.digest(txt)
+
 	parsed, err := g.validateRaw(txt, format)
 	if err != nil {
 		return wrap(err, errfile)
@@ -328,12 +514,11 @@ func (g *generator) generateFile(basedir string, path string) error {
 		return nil
 	}
 
-	err = ioutil.WriteFile(out, txt, filePerm)
-	if err != nil {
-		return err
-	}
+	return g.sink.WriteFile(out, txt, filePerm)
+}
 
-	return nil
+func formatOf(path string) string {
+	return strings.TrimPrefix(filepath.Ext(path), ".")
 }
 
 func outname(out, format string) string {
@@ -347,29 +532,43 @@ func outname(out, format string) string {
 func (g *generator) newRootTemplate(env string, o *Options) (*template.Template, error) {
 	t := template.New(partialPrefix)
 
-	t = t.Funcs(g.templateFuncMap(t))
+	t = t.Funcs(g.templateFuncMap(t, nil, "", nil))
 
-	for _, dir := range o.Templates {
-		dir, err := resolve(env, dir)
-		if err != nil {
-			return nil, wrap(err, dir)
-		}
+	chain, err := envChain(env, o.Inherit)
+	if err != nil {
+		return nil, err
+	}
 
-		err = filepath.Walk(dir,
-			func(path string, info os.FileInfo, err error) error {
+	all, err := layered(o.fsys(), chain, g.dims, o.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	// partials of ancestors are parsed first, so more specific layers can redefine templates
+	dirs := []string{}
+
+	for _, layers := range all {
+		dirs = append(dirs, reverse(layers)...)
+	}
+
+	for _, dir := range dirs {
+		err = fs.WalkDir(o.fsys(), dir,
+			func(path string, entry fs.DirEntry, err error) error {
 				if err != nil {
 					return err
 				}
 
-				if info.IsDir() || !partialGlobe.Match(path) {
+				if entry.IsDir() || !partialGlobe.Match(path) {
 					return nil
 				}
 
-				t, err = t.ParseFiles(path)
+				t, err = g.parseFile(t, path)
 				if err != nil {
 					return wrap(err, path)
 				}
 
+				g.partials[filepath.Base(path)] = path
+
 				return nil
 			})
 		// nolint
@@ -382,67 +581,295 @@ func (g *generator) newRootTemplate(env string, o *Options) (*template.Template,
 }
 
 func (g *generator) newContext(env string, o *Options) (Context, error) {
-	values := Context{}
+	rules, err := newMergeRules(o)
+	if err != nil {
+		return nil, err
+	}
+
+	defined, err := g.newDefined(o)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := envChain(env, o.Inherit)
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := layered(o.fsys(), chain, g.dims, o.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	// the merge annotations of a values file apply to merging the values given by the same spec
+	// (the values file, its inherited layers and the files of values directories)
+	type spec struct {
+		rules  *mergeRules
+		layers [][]Context
+	}
+
+	specs := make([]spec, 0, len(all))
+
+	for _, layers := range all {
+		s := spec{rules: rules.clone(), layers: make([][]Context, 0, len(layers))}
+
+		for _, f := range reverse(layers) {
+			layer, err := g.readValuesLayer(o, f, s.rules)
+			if err != nil {
+				return nil, err
+			}
+
+			s.layers = append(s.layers, layer)
+		}
+
+		specs = append(specs, s)
+	}
+
+	var values interface{} = Context{}
+
+	for _, s := range specs {
+		var layers interface{} = Context{}
+
+		// more specific layers always override their ancestors
+		for _, layer := range s.layers {
+			var files interface{} = Context{}
+
+			// files of a values directory are merged in lexical order, later files win (like conf.d)
+			for _, ctx := range layer {
+				files = s.rules.merge(nil, files, s.rules.mark(nil, ctx), true)
+			}
+
+			layers = s.rules.merge(nil, layers, files, true)
+		}
+
+		values = s.rules.merge(nil, values, layers, false)
+	}
+
+	values = rules.merge(nil, values, rules.mark(nil, map[string]interface{}(defined)), true)
+	values = rules.merge(nil, values, rules.mark(nil, cloneValue(o.Overrides)), true)
 
-	for name, value := range o.Define {
-		values[name] = value
+	m, _ := asMap(strip(values))
+
+	// the merged values (including values of sources and --set flags) are validated by the schema of the values files
+	if schema, ok := Context(m).get(propSchema); ok && !g.loose {
+		if err := g.validate(schema, m); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, file := range o.Values {
-		f, err := resolve(env, file)
+	ctx := Context{}
+
+	// dimensions are available like in path templates
+	for name, value := range g.dims {
+		ctx[name] = value
+	}
+
+	ctx["Values"] = Context(m)
+	ctx["Files"] = &files{fsys: o.fsys()}
+	ctx["Env"] = env
+	ctx["EnvChain"] = chain
+	ctx["Dims"] = dimsContext(g.dims)
+
+	return ctx, nil
+}
+
+// readValuesLayer reads a values file, source or directory and collects the merge annotations.
+func (g *generator) readValuesLayer(o *Options, name string, rules *mergeRules) ([]Context, error) {
+	if !isSource(name) {
+		if info, err := fs.Stat(o.fsys(), name); err == nil && info.IsDir() {
+			return g.readValuesDir(o, name, rules)
+		}
+	}
+
+	ctx, err := g.readValues(o, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rules.annotate(ctx, nil); err != nil {
+		return nil, wrap(err, name)
+	}
+
+	return []Context{ctx}, nil
+}
+
+// readValuesDir reads the values files of the directory (and its subdirectories) in lexical order.
+// Hidden files and files of unknown format are skipped. If Options.ValuesDirKeys is set, the values
+// of a file are placed under the key path given by its relative path (db/primary.yaml: db.primary).
+func (g *generator) readValuesDir(o *Options, dir string, rules *mergeRules) ([]Context, error) {
+	g.values = append(g.values, dir)
+
+	all := []Context{}
+
+	err := fs.WalkDir(o.fsys(), dir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
-			return nil, wrap(err, file)
+			return err
+		}
+
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if _, ok := parsers[valuesFormatOf(path)]; entry.IsDir() || !ok {
+			return nil
 		}
 
-		b, err := ioutil.ReadFile(f)
+		ctx, err := g.readValues(o, path)
 		if err != nil {
-			return nil, wrap(err, f)
+			return err
 		}
 
-		format := strings.TrimPrefix(filepath.Ext(f), ".")
+		var keys []string
 
+		if o.ValuesDirKeys {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			keys = strings.Split(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel))), "/")
+		}
+
+		if err := rules.annotate(ctx, keys); err != nil {
+			return wrap(err, path)
+		}
+
+		if len(keys) != 0 {
+			path := make([]setElem, 0, len(keys))
+
+			for _, key := range keys {
+				path = append(path, setElem{key: key, index: -1})
+			}
+
+			keyed := Context{}
+
+			setIn(keyed, path, map[string]interface{}(ctx))
+
+			ctx = keyed
+		}
+
+		all = append(all, ctx)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return all, nil
+}
+
+func (g *generator) readValues(o *Options, name string) (Context, error) {
+	if source, arg, ok := sourceOf(name); ok {
+		ctx, err := g.sources.read(o, name, source, arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		return ctx, nil
+	}
+
+	b, err := fs.ReadFile(o.fsys(), name)
+	if err != nil {
+		return nil, wrap(err, name)
+	}
+
+	g.values = append(g.values, name)
+
+	format := valuesFormatOf(name)
+
+	if !isAgeEncrypted(b) {
 		ctx := Context{}
 		if err := ctx.unmarshal(b, format); err != nil {
-			return nil, wrap(err, f)
+			return nil, wrap(err, name)
 		}
 
-		if _, err = g.validateRaw(b, format); err != nil {
-			return nil, wrap(err, f)
+		if !isSOPS(ctx) {
+			if err := g.validateValues(ctx); err != nil {
+				return nil, wrap(err, name)
+			}
+
+			return ctx, nil
 		}
+	}
+
+	ctx, err := g.decryptValues(o, b, format)
+	if err != nil {
+		return nil, wrap(err, name)
+	}
+
+	return ctx, nil
+}
 
-		if err := values.merge(ctx); err != nil {
+// decryptValues decrypts an age or SOPS encrypted values file in memory. The decrypted values are
+// registered for redaction and validated like the values of plain values files.
+func (g *generator) decryptValues(o *Options, b []byte, format string) (Context, error) {
+	identities, err := ageIdentities(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if isAgeEncrypted(b) {
+		if b, err = decryptAge(b, identities); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := Context{}
+	if err := ctx.unmarshal(b, format); err != nil {
+		return nil, err
+	}
+
+	secrets := scalars(ctx)
+
+	if isSOPS(ctx) {
+		if secrets, err = decryptSOPS(ctx, b, format, identities); err != nil {
 			return nil, err
 		}
 	}
 
-	return Context{"Values": values, "Files": &files{}, "Env": env}, nil
+	if g.redactor == nil {
+		g.redactor = new(redactor)
+	}
+
+	g.redactor.add(secrets...)
+
+	if err := g.validateValues(ctx); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
 }
 
 func (g *generator) newSchemaLoader(env string, o *Options) (schemaLoaders, error) {
 	loaders := schemaLoaders{}
 
 	for _, dir := range o.Schemas {
-		dir, err := resolve(env, dir)
+		dir, err := (target{env: env, dims: g.dims}).resolve(dir)
 		if err != nil {
 			return nil, wrap(err, dir)
 		}
 
-		err = filepath.Walk(dir,
-			func(path string, info os.FileInfo, err error) error {
+		err = fs.WalkDir(o.fsys(), dir,
+			func(path string, entry fs.DirEntry, err error) error {
 				if err != nil {
 					return err
 				}
 
-				if info.IsDir() || filepath.Ext(path) != ".json" {
+				if entry.IsDir() || filepath.Ext(path) != ".json" {
 					return nil
 				}
 
-				b, err := ioutil.ReadFile(path)
+				b, err := fs.ReadFile(o.fsys(), path)
 				if err != nil {
 					return wrap(err, path)
 				}
 
-				format := strings.TrimPrefix(filepath.Ext(path), ".")
+				format := formatOf(path)
 
 				ctx := Context{}
 				if err := ctx.unmarshal(b, format); err != nil {
@@ -456,6 +883,10 @@ func (g *generator) newSchemaLoader(env string, o *Options) (schemaLoaders, erro
 
 				loaders[id] = gojsonschema.NewGoLoader(ctx)
 
+				if g.schemas != nil {
+					g.schemas[id] = path
+				}
+
 				return nil
 			})
 		// nolint
@@ -467,6 +898,28 @@ func (g *generator) newSchemaLoader(env string, o *Options) (schemaLoaders, erro
 	return loaders, nil
 }
 
+// parseFile parses the named file of the input file system as a template associated with t,
+// named after the base name of the file (like template.ParseFiles does).
+func (g *generator) parseFile(t *template.Template, path string) (*template.Template, error) {
+	b, err := fs.ReadFile(g.fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+
+	tmpl := t
+	if name != t.Name() {
+		tmpl = t.New(name)
+	}
+
+	if _, err := tmpl.Parse(string(b)); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
 const (
 	partialPrefix = "_"
 	dumpSuffix    = "~"
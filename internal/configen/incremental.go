@@ -0,0 +1,296 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoManifest returned when incremental generation is requested without a manifest.
+var ErrNoManifest = errors.New("--since requires --manifest")
+
+// depGraph maps the outputs of a previous run to the input files they depend on.
+type depGraph struct {
+	changed  map[string]bool
+	previous map[depKey][]*FileReport
+}
+
+type depKey struct {
+	env    string
+	dims   string
+	source string
+}
+
+// newIncremental returns the dependency graph for incremental generation,
+// or nil if all outputs should be generated.
+func newIncremental(opts *Options, dir string) (*depGraph, error) {
+	if opts.Previous != nil {
+		return newDepGraph(opts.Previous, opts.Changed), nil
+	}
+
+	if len(opts.Since) == 0 {
+		return nil, nil
+	}
+
+	if len(opts.Manifest) == 0 {
+		return nil, ErrNoManifest
+	}
+
+	name := opts.Manifest
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+
+	m, err := ReadManifest(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil // first run
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := gitChanged(opts.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDepGraph(m.report(filepath.Dir(name)), changed), nil
+}
+
+func newDepGraph(previous *Report, changed []string) *depGraph {
+	d := &depGraph{changed: make(map[string]bool), previous: make(map[depKey][]*FileReport)}
+
+	for _, name := range changed {
+		d.changed[absPath(name)] = true
+	}
+
+	for _, file := range previous.Files {
+		key := depKey{env: file.Env, dims: dimsKey(file.Dims), source: file.Source}
+
+		d.previous[key] = append(d.previous[key], file)
+	}
+
+	return d
+}
+
+// affected reports whether the outputs of source have to be generated for t. Outputs generated with
+// other values or options (digest) or depending on environment variables or secrets are always affected.
+func (d *depGraph) affected(t target, digest string, source string) bool {
+	files, ok := d.previous[depKey{env: t.env, dims: dimsKey(t.dims), source: source}]
+	if !ok {
+		return true
+	}
+
+	for _, file := range files {
+		if file.Err != nil || len(file.Deps) == 0 || file.Digest != digest || file.Volatile {
+			return true
+		}
+
+		for _, dep := range file.Deps {
+			if d.changed[absPath(dep)] || d.changedInside(absPath(dep)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// changedInside reports whether a file inside dir (a values directory dependency) has changed.
+func (d *depGraph) changedInside(dir string) bool {
+	for name := range d.changed {
+		if name != dir && isInside(name, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filter replaces jobs of unaffected templates with jobs reporting the outputs of the previous run.
+func (d *depGraph) filter(t target, digest string, jobs []*job) []*job {
+	filtered := make([]*job, 0, len(jobs))
+
+	for _, j := range jobs {
+		if len(j.source) == 0 || d.affected(t, digest, j.source) {
+			filtered = append(filtered, j)
+
+			continue
+		}
+
+		files := d.previous[depKey{env: t.env, dims: dimsKey(t.dims), source: j.source}]
+
+		filtered = append(filtered, newJob(func(j *job) error {
+			for _, file := range files {
+				j.report.add(file)
+			}
+
+			return nil
+		}))
+	}
+
+	return filtered
+}
+
+// inputsDigest returns the digest of the effective values of ctx (including values of sources, --set flags
+// and overrides) and of the options affecting the outputs.
+func inputsDigest(ctx Context, o *Options) (string, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"values":        ctx["Values"],
+		"templates":     o.Templates,
+		"raws":          o.Raws,
+		"output":        o.Output,
+		"schemas":       o.Schemas,
+		"valuesFiles":   o.Values,
+		"valuesDirKeys": o.ValuesDirKeys,
+		"merge":         []string{o.Merge, o.MergeLists, o.MergeNulls},
+		"axes":          [][]string{o.Axes, o.AxisExclude},
+		"inherit":       o.Inherit,
+		"loose":         o.Loose,
+		"dump":          o.Dump,
+		"secrets":       o.Secrets,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// report converts the manifest back to a report; relative paths are resolved against dir.
+func (m *Manifest) report(dir string) *Report {
+	report := new(Report)
+
+	for _, e := range m.Files {
+		report.add(&FileReport{
+			Env:      e.Env,
+			Dims:     e.Dims,
+			Source:   filepath.FromSlash(e.Source),
+			Path:     filepath.Join(dir, filepath.FromSlash(e.Path)),
+			Format:   e.Format,
+			Schema:   e.Schema,
+			SHA256:   e.SHA256,
+			Size:     e.Size,
+			Deps:     fromSlash(e.Deps),
+			Digest:   e.Digest,
+			Volatile: e.Volatile,
+		})
+	}
+
+	return report
+}
+
+// gitChanged returns the files changed since the given revision, including uncommitted
+// and untracked files. Returned paths are absolute.
+func gitChanged(rev string) ([]string, error) {
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	root := strings.TrimSpace(string(top))
+
+	diff, err := git("-C", root, "diff", "--name-only", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := git("-C", root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(append(diff, untracked...)))
+	for scanner.Scan() {
+		if line := scanner.Text(); len(line) != 0 {
+			changed = append(changed, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+
+	return changed, scanner.Err()
+}
+
+func git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+
+	return filepath.Clean(name)
+}
+
+func toSlash(paths []string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	slashed := make([]string, len(paths))
+
+	for i, p := range paths {
+		slashed[i] = filepath.ToSlash(p)
+	}
+
+	return slashed
+}
+
+func fromSlash(paths []string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	native := make([]string, len(paths))
+
+	for i, p := range paths {
+		native[i] = filepath.FromSlash(p)
+	}
+
+	return native
+}
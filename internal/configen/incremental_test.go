@@ -0,0 +1,151 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_incremental(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"templates/_helpers.tpl": {Data: []byte(`{{ define "name" }}{{ .Values.name }}{{ end }}`)},
+		"templates/a.txt":        {Data: []byte(`{{ $_ := outln "a" }}{{ template "name" . }}`)},
+		"templates/b.txt":        {Data: []byte(`{{ $_ := outln "b" }}{{ .Files.Get "data/b.txt" }}`)},
+		"schemas/c.json":         {Data: []byte(`{"$id":"https://example.com/c.json","type":"object"}`)},
+		"templates/c.yaml":       {Data: []byte("{{ $_ := outln \"c\" }}$schema: https://example.com/c.json\nc: 1\n")},
+		"data/b.txt":             {Data: []byte("b")},
+		"values.yaml":            {Data: []byte("name: a\n")},
+	}
+
+	var stdout bytes.Buffer
+
+	opts := &configen.Options{ // nolint
+		FS:        fsys,
+		Templates: []string{"templates"},
+		Schemas:   []string{"schemas"},
+		Values:    []string{"values.yaml"},
+		Output:    "dist",
+		Define:    map[string]string{},
+		Sink:      configen.NewMemorySink(),
+		Stdout:    &stdout,
+	}
+
+	report, err := configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "a\nb\nc\n", stdout.String())
+	assert.Len(t, report.Files, 3)
+
+	assert.Equal(t, []string{"templates/_helpers.tpl", "templates/a.txt", "values.yaml"}, report.Files[0].Deps)
+	assert.Equal(t, []string{"data/b.txt", "templates/b.txt", "values.yaml"}, report.Files[1].Deps)
+	assert.Equal(t, []string{"schemas/c.json", "templates/c.yaml", "values.yaml"}, report.Files[2].Deps)
+
+	tests := []struct {
+		changed  string
+		expected string
+	}{
+		{changed: "templates/_helpers.tpl", expected: "a\n"},
+		{changed: "data/b.txt", expected: "b\n"},
+		{changed: "schemas/c.json", expected: "c\n"},
+		{changed: "values.yaml", expected: "a\nb\nc\n"},
+		{changed: "README.md", expected: ""},
+	}
+
+	for _, tt := range tests {
+		stdout.Reset()
+
+		incremental := *opts
+		incremental.Previous = report
+		incremental.Changed = []string{filepath.FromSlash(tt.changed)}
+
+		next, err := configen.Render(&incremental, "dev")
+
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, stdout.String(), tt.changed)
+		assert.Equal(t, report.Files, next.Files)
+	}
+}
+
+func TestRender_incremental_values(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"templates/a.txt": {Data: []byte(`{{ $_ := outln "a" }}{{ .Values.name }}`)},
+		"templates/b.txt": {Data: []byte(`{{ $_ := outln "b" }}{{ env "HOME" }}`)},
+		"values.yaml":     {Data: []byte("name: a\n")},
+	}
+
+	var stdout bytes.Buffer
+
+	opts := &configen.Options{ // nolint
+		FS:        fsys,
+		Templates: []string{"templates"},
+		Values:    []string{"env:APP", "values.yaml"},
+		Output:    "dist",
+		Define:    map[string]string{},
+		Environ:   map[string]string{},
+		Sink:      configen.NewMemorySink(),
+		Stdout:    &stdout,
+	}
+
+	report, err := configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assert.False(t, report.Files[0].Volatile)
+	assert.True(t, report.Files[1].Volatile)
+
+	tests := []struct {
+		name     string
+		modify   func(o *configen.Options)
+		expected string
+	}{
+		{name: "unchanged", modify: func(o *configen.Options) {}, expected: "b\n"},
+		{name: "set", modify: func(o *configen.Options) { o.Define = map[string]string{"name": "b"} }, expected: "a\nb\n"},
+		{name: "overrides", modify: func(o *configen.Options) { o.Overrides = map[string]interface{}{"name": "b"} }, expected: "a\nb\n"},
+		{name: "env source", modify: func(o *configen.Options) { o.Environ = map[string]string{"APP__NAME": "b"} }, expected: "a\nb\n"},
+		{name: "options", modify: func(o *configen.Options) { o.Merge = configen.MergeOverride }, expected: "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		stdout.Reset()
+
+		incremental := *opts
+		incremental.Previous = report
+		incremental.Changed = []string{}
+
+		tt.modify(&incremental)
+
+		_, err := configen.Render(&incremental, "dev")
+
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, stdout.String(), tt.name)
+	}
+}
@@ -0,0 +1,140 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInheritanceCycle returned when environment parents form a cycle.
+var ErrInheritanceCycle = errors.New("environment inheritance cycle")
+
+// envChain returns the inheritance chain of env, the root ancestor first and env itself last.
+func envChain(env string, parents map[string]string) ([]string, error) {
+	chain := []string{env}
+	seen := map[string]bool{env: true}
+
+	for parent, ok := parents[env]; ok && len(parent) != 0; parent, ok = parents[parent] {
+		if seen[parent] {
+			return nil, fmt.Errorf("%w: %s", ErrInheritanceCycle, strings.Join(append(reverse(chain), parent), " -> "))
+		}
+
+		seen[parent] = true
+		chain = append([]string{parent}, chain...)
+	}
+
+	return chain, nil
+}
+
+// layered resolves specs (with the dimension values dims) for every environment of chain. For each spec the distinct existing paths
+// are returned, the most specific (resolved for the last environment of chain) first. If none of them
+// exists, the most specific path is returned.
+func layered(fsys fs.FS, chain []string, dims map[string]string, specs []string) ([][]string, error) {
+	all := make([][]string, 0, len(specs))
+
+	for _, spec := range specs {
+		paths := []string{}
+		seen := make(map[string]bool)
+
+		for i := len(chain) - 1; i >= 0; i-- {
+			path, err := (target{env: chain[i], dims: dims}).resolve(spec)
+			if err != nil {
+				return nil, wrap(err, spec)
+			}
+
+			if seen[path] {
+				continue
+			}
+
+			seen[path] = true
+
+			if _, err := fs.Stat(fsys, path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+
+		// if none exists, the most specific path is kept to report the error when it is used
+		if len(paths) == 0 {
+			if path, err := (target{env: chain[len(chain)-1], dims: dims}).resolve(spec); err == nil {
+				paths = append(paths, path)
+			}
+		}
+
+		all = append(all, paths)
+	}
+
+	return all, nil
+}
+
+// walkLayers walks the directory layers (the most specific first) and calls fn for the files
+// not overridden by a file with the same relative path in a more specific layer.
+func walkLayers(fsys fs.FS, layers []string, fn func(dir, rel string, entry fs.DirEntry) error) error {
+	seen := make(map[string]bool)
+
+	for _, dir := range layers {
+		dir := dir
+		err := fs.WalkDir(fsys, dir,
+			func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if entry.IsDir() {
+					return nil
+				}
+
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+
+				if seen[rel] {
+					return nil
+				}
+
+				seen[rel] = true
+
+				return fn(dir, rel, entry)
+			})
+		// nolint
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reverse(strs []string) []string {
+	reversed := make([]string, len(strs))
+
+	for i, s := range strs {
+		reversed[len(strs)-1-i] = s
+	}
+
+	return reversed
+}
@@ -0,0 +1,82 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_inherit(t *testing.T) {
+	t.Parallel()
+
+	sink := configen.NewMemorySink()
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/base/_helpers.tpl": {Data: []byte(`{{ define "region" }}none{{ end }}{{ define "tier" }}base{{ end }}`)},
+			"templates/base/app.txt":      {Data: []byte(`{{ .Values.name }} {{ .Values.replicas }} {{ template "region" }} {{ template "tier" }}`)},
+			"templates/base/env.txt":      {Data: []byte(`{{ .Env }} {{ join "," .EnvChain }}`)},
+			"templates/prod/extra.txt":    {Data: []byte("extra")},
+			"templates/prod-eu/_eu.tpl":   {Data: []byte(`{{ define "region" }}eu{{ end }}`)},
+			"templates/prod-eu/app.txt":   {Data: []byte(`eu: {{ .Values.name }} {{ .Values.replicas }} {{ template "region" }} {{ template "tier" }}`)},
+			"static/base/robots.txt":      {Data: []byte("base")},
+			"static/prod-eu/robots.txt":   {Data: []byte("eu")},
+			"values/base.yaml":            {Data: []byte("name: app\nreplicas: 1\n")},
+			"values/prod.yaml":            {Data: []byte("replicas: 3\n")},
+		},
+		Templates: []string{"templates/{{.Env}}"},
+		Raws:      []string{"static/{{.Env}}"},
+		Values:    []string{"values/{{.Env}}.yaml"},
+		Output:    "dist/{{.Env}}",
+		Define:    map[string]string{},
+		Inherit:   map[string]string{"prod-eu": "prod", "prod": "base"},
+		Sink:      sink,
+		Quiet:     true,
+	}
+
+	_, err := configen.Render(opts, "prod-eu", "prod")
+
+	assert.Nil(t, err)
+
+	files := sink.Files()
+
+	assert.Equal(t, "eu: app 3 eu base", string(files["dist/prod-eu/app.txt"]))
+	assert.Equal(t, "prod-eu base,prod,prod-eu", string(files["dist/prod-eu/env.txt"]))
+	assert.Equal(t, "extra", string(files["dist/prod-eu/extra.txt"]))
+	assert.Equal(t, "eu", string(files["dist/prod-eu/robots.txt"]))
+
+	assert.Equal(t, "app 3 none base", string(files["dist/prod/app.txt"]))
+	assert.Equal(t, "prod base,prod", string(files["dist/prod/env.txt"]))
+	assert.Equal(t, "base", string(files["dist/prod/robots.txt"]))
+
+	opts.Inherit = map[string]string{"a": "b", "b": "a"}
+
+	_, err = configen.Render(opts, "a")
+
+	assert.True(t, errors.Is(err, configen.ErrInheritanceCycle))
+}
@@ -0,0 +1,129 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// job is a unit of work of a generation run: rendering a template or copying raw files.
+// Jobs collect their file reports and console output separately, so they can run in parallel
+// and the results can still be reported in a deterministic order.
+type job struct {
+	run      func(*job) error
+	source   string // template file rendered by the job (empty for copying raw files)
+	report   Report
+	console  bytes.Buffer
+	deps     map[string]bool
+	volatile bool // depends on environment variables or secrets
+	err      error
+}
+
+func newJob(run func(*job) error) *job {
+	return &job{run: run}
+}
+
+// runJobs runs jobs on the given number of workers. The console output and the reports of the jobs
+// are written to out and report in the order of jobs. The returned error is the error of the first
+// failed job in that order, just like when jobs run one after another. Unless keepGoing is set,
+// jobs after a failed one are skipped: each job checks for an earlier failure right before it runs.
+// Jobs already running when another one fails can not be interrupted, their output files are written
+// (into the staging directories, unless output is written in place).
+func runJobs(jobs []*job, workers int, keepGoing bool, out io.Writer, report *Report) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = len(jobs)
+		done   = make([]bool, len(jobs))
+		next   int
+		queue  = make(chan int)
+	)
+
+	// writes console output of finished jobs, in order; jobs before next are all done,
+	// so the output of jobs after a failed one is never written
+	flush := func() {
+		for next < len(jobs) && done[next] {
+			if next <= failed {
+				out.Write(jobs[next].console.Bytes()) // nolint
+			}
+
+			next++
+		}
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range queue {
+				j := jobs[idx]
+
+				mu.Lock()
+				skip := idx > failed
+				mu.Unlock()
+
+				if !skip {
+					j.err = j.run(j)
+				}
+
+				mu.Lock()
+				if j.err != nil && !keepGoing && idx < failed {
+					failed = idx
+				}
+
+				done[idx] = true
+				flush()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for idx := range jobs {
+		queue <- idx
+	}
+
+	close(queue)
+	wg.Wait()
+
+	for idx, j := range jobs {
+		if keepGoing || idx <= failed {
+			report.Files = append(report.Files, j.report.Files...)
+		}
+	}
+
+	for _, j := range jobs {
+		if j.err != nil {
+			return j.err
+		}
+	}
+
+	return nil
+}
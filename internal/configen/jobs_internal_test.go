@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errJob = errors.New("job error")
+
+func testJobs(fail ...int) []*job {
+	jobs := make([]*job, 6)
+
+	for i := range jobs {
+		i := i
+		jobs[i] = newJob(func(j *job) error {
+			// earlier jobs finish later
+			time.Sleep(time.Duration(len(jobs)-i) * time.Millisecond)
+
+			fmt.Fprintf(&j.console, "%d;", i)
+			j.report.add(&FileReport{Path: fmt.Sprint(i)})
+
+			for _, f := range fail {
+				if f == i {
+					return fmt.Errorf("%w: %d", errJob, i)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	return jobs
+}
+
+func Test_runJobs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		fail      []int
+		keepGoing bool
+		want      string
+		wantFiles int
+		wantErr   string
+	}{
+		{name: "normal", want: "0;1;2;3;4;5;", wantFiles: 6},
+		{name: "first error", fail: []int{4, 2}, want: "0;1;2;", wantFiles: 3, wantErr: "job error: 2"},
+		{name: "keep going", fail: []int{4, 2}, keepGoing: true, want: "0;1;2;3;4;5;", wantFiles: 6, wantErr: "job error: 2"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+
+			report := new(Report)
+
+			err := runJobs(testJobs(tt.fail...), 4, tt.keepGoing, &out, report)
+
+			if len(tt.wantErr) != 0 {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tt.want, out.String())
+			assert.Len(t, report.Files, tt.wantFiles)
+
+			for i, f := range report.Files {
+				assert.Equal(t, fmt.Sprint(i), f.Path)
+			}
+		})
+	}
+}
+
+func Test_runJobs_stop(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		ran []int
+	)
+
+	jobs := make([]*job, 6)
+
+	for i := range jobs {
+		i := i
+		jobs[i] = newJob(func(j *job) error {
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+
+			if i == 0 {
+				return errJob
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			return nil
+		})
+	}
+
+	err := runJobs(jobs, 2, false, new(bytes.Buffer), new(Report))
+
+	assert.True(t, errors.Is(err, errJob))
+
+	for _, i := range ran {
+		assert.LessOrEqual(t, i, 1, "jobs after the failed one are not started")
+	}
+}
@@ -0,0 +1,219 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	statusValid        = "valid"
+	statusInvalid      = "invalid"
+	statusFailed       = "failed"
+	statusNotValidated = "not validated"
+)
+
+// listingEntry is a row of a directory listing.
+type listingEntry struct {
+	Name    string
+	Href    string
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+	Format  string
+	Schema  string
+	Status  string
+	Error   string
+}
+
+// placeholder is the content of the index.html files created in output directories by earlier versions.
+const placeholder = "<html></html>"
+
+// isPlaceholder reports whether path is an index.html placeholder created by earlier versions.
+// Placeholders are listed like missing index.html files; --prune removes them.
+func isPlaceholder(path string) bool {
+	if filepath.Base(path) != "index.html" {
+		return false
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	return err == nil && string(b) == placeholder
+}
+
+// listing renders indexes of the directories under s.dir which have no index.html (or a placeholder), showing
+// metadata of the files reported by the last generation. Other requests are passed to next.
+func (s *server) listing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		root := s.dir
+		if len(root) == 0 {
+			root = "."
+		}
+
+		dir := filepath.Join(root, filepath.FromSlash(name))
+
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		index := filepath.Join(dir, "index.html")
+
+		if _, err := os.Stat(index); err == nil && !isPlaceholder(index) {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if r.URL.Path[len(r.URL.Path)-1] != '/' {
+			http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+
+			return
+		}
+
+		entries, err := s.listingEntries(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		var buff bytes.Buffer
+
+		data := map[string]interface{}{"Path": name, "Root": name == "/", "Entries": entries}
+
+		if err := listingTemplate.Execute(&buff, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(injectScript(buff.Bytes(), pageScript(s.status.overlay))) // nolint
+	})
+}
+
+func (s *server) listingEntries(dir string) ([]*listingEntry, error) {
+	files := make(map[string]*FileReport)
+
+	if st := s.status.get(); st != nil && st.report != nil {
+		for _, f := range st.report.Files {
+			files[absPath(f.Path)] = f
+		}
+	}
+
+	dirents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*listingEntry, 0, len(dirents))
+
+	for _, d := range dirents {
+		info, err := d.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+
+		e := &listingEntry{Name: d.Name(), Href: d.Name(), Dir: d.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+
+		if e.Dir {
+			e.Href += "/"
+		} else if f, ok := files[absPath(filepath.Join(dir, d.Name()))]; ok {
+			e.Format = f.Format
+			e.Schema = f.Schema
+			e.Status, e.Error = s.validationStatus(f)
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Dir && !entries[j].Dir
+	})
+
+	return entries, nil
+}
+
+func (s *server) validationStatus(f *FileReport) (string, string) {
+	switch {
+	case f.Err != nil && errors.Is(f.Err, ErrValidationError):
+		return statusInvalid, f.Err.Error()
+	case f.Err != nil:
+		return statusFailed, f.Err.Error()
+	case len(f.Schema) == 0 || s.opts.Loose:
+		return statusNotValidated, ""
+	default:
+		return statusValid, ""
+	}
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Path }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: .25em 1em .25em 0; }
+td.size { text-align: right; }
+.valid { color: green; }
+.invalid, .failed { color: red; }
+.not-validated { color: gray; }
+</style>
+</head>
+<body>
+<h1>{{ .Path }}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>Format</th><th>Schema</th><th>Validation</th></tr>
+{{- if not .Root }}
+<tr><td><a href="../">../</a></td><td></td><td></td><td></td><td></td><td></td></tr>
+{{- end }}
+{{- range .Entries }}
+<tr>
+<td><a href="{{ .Href }}">{{ .Href }}</a></td>
+<td class="size">{{ if not .Dir }}{{ .Size }}{{ end }}</td>
+<td>{{ .ModTime.Format "2006-01-02 15:04:05" }}</td>
+<td>{{ .Format }}</td>
+<td>{{ .Schema }}</td>
+<td{{ if .Status }} class="{{ if eq .Status "not validated" }}not-validated{{ else }}{{ .Status }}{{ end }}"{{ end }}{{ if .Error }} title="{{ .Error }}"{{ end }}>{{ .Status }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
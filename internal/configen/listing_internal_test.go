@@ -0,0 +1,169 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_listing(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "site"), 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<html>site</html>"), 0o600))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "legacy"), 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "legacy", "index.html"), []byte(placeholder), 0o600))
+
+	files := map[string]error{
+		"valid.yaml":   nil,
+		"invalid.yaml": fmt.Errorf("%w: name is required", ErrValidationError),
+		"plain.txt":    nil,
+	}
+
+	report := new(Report)
+
+	for name, err := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600))
+
+		f := &FileReport{Path: filepath.Join(dir, name), Format: formatOf(name), Err: err}
+		if f.Format == "yaml" {
+			f.Schema = "https://example.com/schema.json"
+		}
+
+		report.add(f)
+	}
+
+	s := &server{dir: dir, opts: new(Options), status: new(statusHolder)}
+
+	s.status.set(newRunStatus(time.Now(), report, report.Err()))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	srv := httptest.NewServer(s.listing(next))
+	defer srv.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	get := func(path string) (int, string) {
+		res, err := client.Get(srv.URL + path)
+
+		assert.Nil(t, err)
+
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+
+		assert.Nil(t, err)
+
+		return res.StatusCode, string(b)
+	}
+
+	code, body := get("/")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `<a href="sub/">sub/</a>`)
+	assert.Contains(t, body, `<td class="valid">valid</td>`)
+	assert.Contains(t, body, `<td class="invalid" title="validation error: name is required">invalid</td>`)
+	assert.Contains(t, body, `https://example.com/schema.json`)
+	assert.Contains(t, body, eventsPath)
+	assert.Contains(t, body, "configen-overlay")
+	assert.NotContains(t, body, `href="../"`)
+
+	code, body = get("/sub/")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `href="../"`)
+
+	code, _ = get("/sub")
+
+	assert.Equal(t, http.StatusMovedPermanently, code)
+
+	code, _ = get("/site/")
+
+	assert.Equal(t, http.StatusTeapot, code)
+
+	code, body = get("/legacy/")
+
+	assert.Equal(t, http.StatusOK, code, "placeholder of earlier versions")
+	assert.Contains(t, body, `<a href="index.html">index.html</a>`)
+
+	code, _ = get("/valid.yaml")
+
+	assert.Equal(t, http.StatusTeapot, code)
+}
+
+func TestServer_handler_placeholder(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "legacy"), 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "legacy", "index.html"), []byte(placeholder), 0o600))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "site"), 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<html>site</html>"), 0o600))
+
+	s := &server{dir: dir, opts: new(Options), status: new(statusHolder), events: newBroadcaster()}
+
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	get := func(path string) string {
+		res, err := http.Get(srv.URL + path)
+
+		assert.Nil(t, err)
+
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode, path)
+
+		return string(b)
+	}
+
+	body := get("/legacy/")
+
+	assert.Contains(t, body, `<a href="index.html">index.html</a>`, "placeholder of earlier versions is listed")
+	assert.Contains(t, body, eventsPath)
+
+	body = get("/site/")
+
+	assert.Contains(t, body, "site")
+	assert.NotContains(t, body, "<table>")
+	assert.Contains(t, body, eventsPath, "pages are served with the reload script")
+}
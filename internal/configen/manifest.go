@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+)
+
+const manifestVersion = 1
+
+// Manifest describes the files emitted by a generation run.
+type Manifest struct {
+	Version int              `json:"version"`
+	Files   []*ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes a single emitted file. Paths are slash separated and relative to the manifest's directory.
+type ManifestEntry struct {
+	Path     string            `json:"path"`
+	Source   string            `json:"source"`
+	Env      string            `json:"env,omitempty"`
+	Dims     map[string]string `json:"dims,omitempty"`
+	Format   string            `json:"format,omitempty"`
+	Schema   string            `json:"schema,omitempty"`
+	SHA256   string            `json:"sha256"`
+	Size     int               `json:"size"`
+	Deps     []string          `json:"deps,omitempty"`
+	Digest   string            `json:"digest,omitempty"`
+	Volatile bool              `json:"volatile,omitempty"`
+}
+
+func newManifest(report *Report, dir string) (*Manifest, error) {
+	m := &Manifest{Version: manifestVersion, Files: make([]*ManifestEntry, 0, len(report.Files))}
+
+	for _, file := range report.Files {
+		rel, err := filepath.Rel(dir, file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Files = append(m.Files, &ManifestEntry{
+			Path:     filepath.ToSlash(rel),
+			Source:   filepath.ToSlash(file.Source),
+			Env:      file.Env,
+			Dims:     file.Dims,
+			Format:   file.Format,
+			Schema:   file.Schema,
+			SHA256:   file.SHA256,
+			Size:     file.Size,
+			Deps:     toSlash(file.Deps),
+			Digest:   file.Digest,
+			Volatile: file.Volatile,
+		})
+	}
+
+	return m, nil
+}
+
+// writeManifest writes the manifest of report as opts.Manifest into dir (if opts.Manifest is relative).
+// The manifest contains no timestamps, so an unchanged run produces the same manifest.
+func writeManifest(report *Report, opts *Options, dir string) error {
+	out := opts.Manifest
+
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+
+	m, err := newManifest(report, filepath.Dir(out))
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+
+	file := &FileReport{Path: out, Format: formatOf(out)}
+
+	file.digest(b)
+	report.add(file)
+
+	return opts.sink().WriteFile(out, b, filePerm)
+}
+
+// ReadManifest reads a manifest written by a previous generation run.
+func ReadManifest(path string) (*Manifest, error) {
+	b, err := fs.ReadFile(osFS{}, path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Manifest)
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, wrap(err, path)
+	}
+
+	return m, nil
+}
@@ -0,0 +1,82 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_manifest(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.yaml": {Data: []byte("$schema: https://example.com/app.json\n$format: toml\nname: app\n")},
+			"static/raw.txt":     {Data: []byte("raw\n")},
+		},
+		Templates: []string{"templates"},
+		Raws:      []string{"static"},
+		Output:    filepath.Join(out, "{{.Env}}"),
+		Define:    map[string]string{},
+		Manifest:  ".configen-manifest.json",
+		Loose:     true,
+	}
+
+	assert.Nil(t, configen.Generate(opts, "dev", "prod"))
+
+	m, err := configen.ReadManifest(filepath.Join(out, ".configen-manifest.json"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, m.Version)
+	assert.Len(t, m.Files, 4)
+
+	entry := m.Files[0]
+
+	assert.Equal(t, "dev/app.toml", entry.Path)
+	assert.Equal(t, "templates/app.yaml", entry.Source)
+	assert.Equal(t, "dev", entry.Env)
+	assert.Equal(t, "toml", entry.Format)
+	assert.Equal(t, "https://example.com/app.json", entry.Schema)
+
+	b, err := ioutil.ReadFile(filepath.Join(out, "dev", "app.toml"))
+
+	assert.Nil(t, err)
+
+	sum := sha256.Sum256(b)
+
+	assert.Equal(t, hex.EncodeToString(sum[:]), entry.SHA256)
+	assert.Equal(t, len(b), entry.Size)
+
+	assert.Equal(t, "prod/raw.txt", m.Files[3].Path)
+	assert.Equal(t, "static/raw.txt", m.Files[3].Source)
+}
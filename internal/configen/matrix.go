@@ -0,0 +1,268 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidAxis returned for malformed matrix dimensions and exclusions.
+var ErrInvalidAxis = errors.New("invalid axis")
+
+// target is an environment combined with values of the matrix dimensions (see Options.Axes).
+type target struct {
+	env  string
+	dims map[string]string
+}
+
+// vars returns the variables available in path templates.
+func (t target) vars() Context {
+	vars := Context{"Env": t.env}
+
+	for name, value := range t.dims {
+		vars[name] = value
+	}
+
+	return vars
+}
+
+func (t target) resolve(str string) (string, error) {
+	return resolveVars(t.vars(), str)
+}
+
+// dimsKey returns the canonical string form of dims, like "region=eu,tenant=a".
+func dimsKey(dims map[string]string) string {
+	pairs := make([]string, 0, len(dims))
+
+	for name, value := range dims {
+		pairs = append(pairs, name+"="+value)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+// dimsContext returns dims as a template context (empty if there are no dimensions).
+func dimsContext(dims map[string]string) Context {
+	ctx := make(Context, len(dims))
+
+	for name, value := range dims {
+		ctx[name] = value
+	}
+
+	return ctx
+}
+
+type axis struct {
+	name   string
+	values []string
+}
+
+// targets expands envs with every combination of the matrix dimensions of opts,
+// leaving out the excluded combinations. Without dimensions every env is a target.
+func targets(opts *Options, envs []string) ([]target, error) {
+	axes, err := parseAxes(opts.Axes)
+	if err != nil {
+		return nil, err
+	}
+
+	excludes, err := parseExcludes(opts.AxisExclude)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]target, 0, len(envs))
+
+	for _, env := range envs {
+		combos := []map[string]string{{}}
+
+		for _, a := range axes {
+			next := make([]map[string]string, 0, len(combos)*len(a.values))
+
+			for _, combo := range combos {
+				for _, value := range a.values {
+					dims := make(map[string]string, len(combo)+1)
+
+					for k, v := range combo {
+						dims[k] = v
+					}
+
+					dims[a.name] = value
+					next = append(next, dims)
+				}
+			}
+
+			combos = next
+		}
+
+		for _, dims := range combos {
+			if excluded(env, dims, excludes) {
+				continue
+			}
+
+			if len(dims) == 0 {
+				dims = nil
+			}
+
+			all = append(all, target{env: env, dims: dims})
+		}
+	}
+
+	return all, nil
+}
+
+// checkOutputs returns an error if matrix combinations would be generated into the same output directory,
+// overwriting each other (the output path does not use every dimension).
+func checkOutputs(all []target, output string) error {
+	seen := make(map[string]target, len(all))
+
+	for _, t := range all {
+		dir, err := t.resolve(output)
+		if err != nil {
+			return wrap(err, output)
+		}
+
+		dir = filepath.Clean(dir)
+
+		if other, ok := seen[dir]; ok && (len(t.dims) != 0 || len(other.dims) != 0) {
+			return fmt.Errorf("%w: %s and %s are both generated into %s (use the dimensions in the output path)",
+				ErrInvalidAxis, other.name(), t.name(), dir)
+		}
+
+		seen[dir] = t
+	}
+
+	return nil
+}
+
+// name returns the env and the dimensions of the target, like "prod[region=eu]".
+func (t target) name() string {
+	if len(t.dims) == 0 {
+		return "@" + t.env
+	}
+
+	return "@" + t.env + "[" + dimsKey(t.dims) + "]"
+}
+
+func excluded(env string, dims map[string]string, excludes []map[string]string) bool {
+	for _, exclude := range excludes {
+		match := true
+
+		for name, value := range exclude {
+			actual, ok := dims[name]
+			if name == envAxis {
+				actual, ok = env, true
+			}
+
+			if !ok || actual != value {
+				match = false
+
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseAxes parses dimensions given as "name=value,value...".
+func parseAxes(specs []string) ([]axis, error) {
+	axes := make([]axis, 0, len(specs))
+	seen := make(map[string]bool)
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("%w: %s (expected name=value,...)", ErrInvalidAxis, spec)
+		}
+
+		name := parts[0]
+
+		if err := checkAxisName(name); err != nil {
+			return nil, err
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate axis %s", ErrInvalidAxis, name)
+		}
+
+		seen[name] = true
+
+		axes = append(axes, axis{name: name, values: strings.Split(parts[1], ",")})
+	}
+
+	return axes, nil
+}
+
+// parseExcludes parses exclusions given as "name=value,name=value...". The env name matches the environment.
+func parseExcludes(specs []string) ([]map[string]string, error) {
+	excludes := make([]map[string]string, 0, len(specs))
+
+	for _, spec := range specs {
+		exclude := make(map[string]string)
+
+		for _, pair := range strings.Split(spec, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%w: %s (expected name=value,...)", ErrInvalidAxis, spec)
+			}
+
+			exclude[parts[0]] = parts[1]
+		}
+
+		excludes = append(excludes, exclude)
+	}
+
+	return excludes, nil
+}
+
+func checkAxisName(name string) error {
+	if !axisNameRE.MatchString(name) {
+		return fmt.Errorf("%w: %s is not a valid name", ErrInvalidAxis, name)
+	}
+
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("%w: %s is a reserved name", ErrInvalidAxis, name)
+		}
+	}
+
+	return nil
+}
+
+const envAxis = "env"
+
+var (
+	axisNameRE    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	reservedNames = []string{"Env", "EnvChain", "Values", "Files", "Dims", "Document"}
+)
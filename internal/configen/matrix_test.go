@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_matrix(t *testing.T) {
+	t.Parallel()
+
+	sink := configen.NewMemorySink()
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.txt": {Data: []byte(`{{ .Env }} {{ .region }} {{ .Dims.tenant }}`)},
+		},
+		Templates:   []string{"templates"},
+		Output:      "dist/{{.Env}}/{{.region}}/{{.tenant}}",
+		Define:      map[string]string{},
+		Axes:        []string{"region=eu,us", "tenant=a,b"},
+		AxisExclude: []string{"region=us,tenant=b", "env=dev,region=eu"},
+		Sink:        sink,
+		Quiet:       true,
+	}
+
+	report, err := configen.Render(opts, "prod", "dev")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"dist/dev/us/a/app.txt",
+		"dist/prod/eu/a/app.txt",
+		"dist/prod/eu/b/app.txt",
+		"dist/prod/us/a/app.txt",
+	}, sink.Names())
+
+	assert.Equal(t, "prod eu b", string(sink.Files()["dist/prod/eu/b/app.txt"]))
+	assert.Equal(t, map[string]string{"region": "eu", "tenant": "a"}, report.Files[0].Dims)
+}
+
+func TestRender_matrix_invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		axes    []string
+		exclude []string
+	}{
+		{name: "no values", axes: []string{"region"}},
+		{name: "empty values", axes: []string{"region="}},
+		{name: "invalid name", axes: []string{"the-region=eu"}},
+		{name: "reserved name", axes: []string{"values=a"}},
+		{name: "env", axes: []string{"env=a"}},
+		{name: "duplicate", axes: []string{"region=eu", "region=us"}},
+		{name: "exclude", axes: []string{"region=eu"}, exclude: []string{"region"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := &configen.Options{ // nolint
+				FS:          fstest.MapFS{},
+				Output:      "dist",
+				Axes:        tt.axes,
+				AxisExclude: tt.exclude,
+				Sink:        configen.NewMemorySink(),
+			}
+
+			_, err := configen.Render(opts, "dev")
+
+			assert.True(t, errors.Is(err, configen.ErrInvalidAxis))
+		})
+	}
+}
+
+func TestRender_matrix_overlap(t *testing.T) {
+	t.Parallel()
+
+	opts := &configen.Options{ // nolint
+		FS:        fstest.MapFS{"templates/app.txt": {Data: []byte(`{{ .region }}`)}},
+		Templates: []string{"templates"},
+		Output:    "dist/{{.Env}}",
+		Define:    map[string]string{},
+		Axes:      []string{"region=eu,us"},
+		Sink:      configen.NewMemorySink(),
+		Quiet:     true,
+	}
+
+	_, err := configen.Render(opts, "prod")
+
+	assert.True(t, errors.Is(err, configen.ErrInvalidAxis))
+
+	opts.Output = "dist/{{.Env}}/{{.region}}"
+
+	_, err = configen.Render(opts, "prod")
+
+	assert.Nil(t, err)
+}
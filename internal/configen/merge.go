@@ -0,0 +1,367 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMerge returned for unknown merge strategies and malformed merge annotations.
+var ErrInvalidMerge = errors.New("invalid merge")
+
+// Merge strategies: which values file wins if both contain a value.
+const (
+	MergeKeepFirst = "keep-first" // the earlier values file wins
+	MergeOverride  = "override"   // the later values file wins
+)
+
+// List merge modes.
+const (
+	ListsReplace     = "replace" // the list of the winning values file is used
+	ListsAppend      = "append"  // items of the later list are appended to the earlier one
+	ListsMergePrefix = "merge:"  // items (maps) with the same value of the named field are merged
+)
+
+// Null handling modes.
+const (
+	NullsIgnore = "ignore" // null does not override other values
+	NullsDelete = "delete" // null removes the key
+)
+
+// mergeKey is the key of the merge annotation in values files.
+const mergeKey = "$merge"
+
+// mergeRule describes how values are merged. Empty fields are inherited.
+type mergeRule struct {
+	Strategy string `json:"strategy,omitempty"`
+	Lists    string `json:"lists,omitempty"`
+	Nulls    string `json:"nulls,omitempty"`
+}
+
+func (r mergeRule) validate() error {
+	if r.Strategy != "" && r.Strategy != MergeKeepFirst && r.Strategy != MergeOverride {
+		return fmt.Errorf("%w: unknown strategy %q", ErrInvalidMerge, r.Strategy)
+	}
+
+	if r.Lists != "" && r.Lists != ListsReplace && r.Lists != ListsAppend &&
+		(!strings.HasPrefix(r.Lists, ListsMergePrefix) || r.Lists == ListsMergePrefix) {
+		return fmt.Errorf("%w: unknown list mode %q", ErrInvalidMerge, r.Lists)
+	}
+
+	if r.Nulls != "" && r.Nulls != NullsIgnore && r.Nulls != NullsDelete {
+		return fmt.Errorf("%w: unknown null mode %q", ErrInvalidMerge, r.Nulls)
+	}
+
+	return nil
+}
+
+// with returns the rule with the not empty fields of other.
+func (r mergeRule) with(other mergeRule) mergeRule {
+	if len(other.Strategy) != 0 {
+		r.Strategy = other.Strategy
+	}
+
+	if len(other.Lists) != 0 {
+		r.Lists = other.Lists
+	}
+
+	if len(other.Nulls) != 0 {
+		r.Nulls = other.Nulls
+	}
+
+	return r
+}
+
+// mergeRules holds the global rule and the rules of key paths (keys joined by a zero byte).
+type mergeRules struct {
+	global mergeRule
+	paths  map[string]mergeRule
+}
+
+func newMergeRules(o *Options) (*mergeRules, error) {
+	global := mergeRule{Strategy: MergeKeepFirst, Lists: ListsReplace, Nulls: NullsIgnore}
+	flags := mergeRule{Strategy: o.Merge, Lists: o.MergeLists, Nulls: o.MergeNulls}
+
+	if err := flags.validate(); err != nil {
+		return nil, err
+	}
+
+	return &mergeRules{global: global.with(flags), paths: make(map[string]mergeRule)}, nil
+}
+
+// clone returns a copy of the rules, so the annotations of a values file do not affect other values files.
+func (rs *mergeRules) clone() *mergeRules {
+	paths := make(map[string]mergeRule, len(rs.paths))
+
+	for k, v := range rs.paths {
+		paths[k] = v
+	}
+
+	return &mergeRules{global: rs.global, paths: paths}
+}
+
+// rule returns the rule of the path: the global rule refined by the rules of the path's prefixes.
+func (rs *mergeRules) rule(path []string) mergeRule {
+	r := rs.global
+
+	for i := 1; i <= len(path); i++ {
+		if pr, ok := rs.paths[strings.Join(path[:i], "\x00")]; ok {
+			r = r.with(pr)
+		}
+	}
+
+	return r
+}
+
+// annotate removes the merge annotation from ctx and adds its rules, the paths of the annotation
+// being relative to prefix (the key path of ctx). The annotation looks like:
+//
+//	$merge:
+//	  strategy: override
+//	  paths:
+//	    servers: {lists: "merge:name"}
+func (rs *mergeRules) annotate(ctx Context, prefix []string) error {
+	raw, ok := ctx[mergeKey]
+	if !ok {
+		return nil
+	}
+
+	delete(ctx, mergeKey)
+
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	var annotation struct {
+		mergeRule
+		Paths map[string]mergeRule `json:"paths,omitempty"`
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&annotation); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMerge, err)
+	}
+
+	if err := annotation.mergeRule.validate(); err != nil {
+		return err
+	}
+
+	if len(prefix) == 0 {
+		rs.global = rs.global.with(annotation.mergeRule)
+	} else {
+		key := strings.Join(prefix, "\x00")
+
+		rs.paths[key] = rs.paths[key].with(annotation.mergeRule)
+	}
+
+	for name, rule := range annotation.Paths {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+
+		elems, err := parseSetPath(name)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidMerge, err)
+		}
+
+		keys := append(make([]string, 0, len(prefix)+len(elems)), prefix...)
+
+		for _, elem := range elems {
+			if elem.index >= 0 {
+				return fmt.Errorf("%w: index in path %q", ErrInvalidMerge, name)
+			}
+
+			keys = append(keys, elem.key)
+		}
+
+		key := strings.Join(keys, "\x00")
+
+		rs.paths[key] = rs.paths[key].with(rule)
+	}
+
+	return nil
+}
+
+// tombstone is the value of a key deleted by null (see mark), it is removed by strip after merging.
+type tombstone struct{}
+
+// mark replaces null values by tombstones in value, if the rule of the key says so.
+func (rs *mergeRules) mark(path []string, value interface{}) interface{} {
+	if m, ok := asMap(value); ok {
+		for k, v := range m {
+			p := append(path[:len(path):len(path)], k)
+
+			if v == nil && rs.rule(p).Nulls == NullsDelete {
+				m[k] = tombstone{}
+
+				continue
+			}
+
+			m[k] = rs.mark(p, v)
+		}
+
+		return value
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		for i, item := range list {
+			list[i] = rs.mark(path, item)
+		}
+	}
+
+	return value
+}
+
+// merge merges the later value into the earlier one at path. If force is set, the later value wins
+// regardless of the strategy. Null values do not override other values, tombstones (see mark) do.
+func (rs *mergeRules) merge(path []string, earlier, later interface{}, force bool) interface{} {
+	rule := rs.rule(path)
+
+	high, low := earlier, later
+	if force || rule.Strategy == MergeOverride {
+		high, low = later, earlier
+	}
+
+	if high == nil {
+		return low
+	}
+
+	if _, deleted := high.(tombstone); deleted || low == nil {
+		return high
+	}
+
+	if _, deleted := low.(tombstone); deleted {
+		return high
+	}
+
+	if em, ok := asMap(earlier); ok {
+		if lm, ok := asMap(later); ok {
+			return rs.mergeMaps(path, em, lm, force)
+		}
+	}
+
+	if el, ok := earlier.([]interface{}); ok {
+		if ll, ok := later.([]interface{}); ok {
+			return rs.mergeLists(path, rule, el, ll, high, force)
+		}
+	}
+
+	return high
+}
+
+func (rs *mergeRules) mergeMaps(path []string, earlier, later map[string]interface{}, force bool) interface{} {
+	m := make(map[string]interface{}, len(earlier)+len(later))
+
+	for k, v := range earlier {
+		m[k] = v
+	}
+
+	for k, v := range later {
+		if ev, ok := earlier[k]; ok {
+			m[k] = rs.merge(append(path[:len(path):len(path)], k), ev, v, force)
+		} else {
+			m[k] = v
+		}
+	}
+
+	return m
+}
+
+func (rs *mergeRules) mergeLists(path []string, rule mergeRule, earlier, later []interface{}, high interface{},
+	force bool) interface{} {
+	switch {
+	case rule.Lists == ListsAppend:
+		return append(append(make([]interface{}, 0, len(earlier)+len(later)), earlier...), later...)
+	case strings.HasPrefix(rule.Lists, ListsMergePrefix):
+		field := strings.TrimPrefix(rule.Lists, ListsMergePrefix)
+		list := append(make([]interface{}, 0, len(earlier)+len(later)), earlier...)
+		index := make(map[string]int)
+
+		for i, item := range earlier {
+			if id, ok := itemID(item, field); ok {
+				index[id] = i
+			}
+		}
+
+		for _, item := range later {
+			id, ok := itemID(item, field)
+			if i, found := index[id]; ok && found {
+				list[i] = rs.merge(path, list[i], item, force)
+
+				continue
+			}
+
+			list = append(list, item)
+		}
+
+		return list
+	default:
+		return high
+	}
+}
+
+// strip removes the keys deleted by tombstones.
+func strip(value interface{}) interface{} {
+	if m, ok := asMap(value); ok {
+		for k, v := range m {
+			if _, deleted := v.(tombstone); deleted {
+				delete(m, k)
+
+				continue
+			}
+
+			m[k] = strip(v)
+		}
+
+		return m
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		for i, item := range list {
+			list[i] = strip(item)
+		}
+	}
+
+	return value
+}
+
+func itemID(item interface{}, field string) (string, bool) {
+	m, ok := asMap(item)
+	if !ok {
+		return "", false
+	}
+
+	v, ok := m[field]
+	if !ok || v == nil {
+		return "", false
+	}
+
+	return fmt.Sprint(v), true
+}
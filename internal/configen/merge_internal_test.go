@@ -0,0 +1,205 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_newContext_merge(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"base.yaml": {Data: []byte(`
+name: base
+debug: true
+servers: [{name: a, port: 1}, {name: b, port: 2}]
+tags: [x]
+`)},
+		"prod.yaml": {Data: []byte(`
+name: prod
+debug: null
+servers: [{name: b, port: 3}, {name: c, port: 4}]
+tags: [y]
+`)},
+		"annotated.yaml": {Data: []byte(`
+$merge:
+  strategy: override
+  paths:
+    servers: {lists: "merge:name"}
+    debug: {nulls: delete}
+name: prod
+debug: null
+servers: [{name: b, port: 3}, {name: c, port: 4}]
+`)},
+		"bad.yaml": {Data: []byte("$merge: {lists: prepend}\n")},
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		want    Context
+		wantErr bool
+	}{
+		{
+			name: "keep-first",
+			opts: Options{Values: []string{"base.yaml", "prod.yaml"}}, // nolint
+			want: Context{
+				"name":    "base",
+				"debug":   true,
+				"servers": []interface{}{map[string]interface{}{"name": "a", "port": 1.0}, map[string]interface{}{"name": "b", "port": 2.0}}, // nolint:lll
+				"tags":    []interface{}{"x"},
+			},
+		},
+		{
+			name: "override",
+			opts: Options{Values: []string{"base.yaml", "prod.yaml"}, Merge: MergeOverride}, // nolint
+			want: Context{
+				"name":    "prod",
+				"debug":   true,
+				"servers": []interface{}{map[string]interface{}{"name": "b", "port": 3.0}, map[string]interface{}{"name": "c", "port": 4.0}}, // nolint:lll
+				"tags":    []interface{}{"y"},
+			},
+		},
+		{
+			name: "append and delete",
+			opts: Options{Values: []string{"base.yaml", "prod.yaml"}, Merge: MergeOverride, MergeLists: ListsAppend, MergeNulls: NullsDelete}, // nolint
+			want: Context{
+				"name": "prod",
+				"servers": []interface{}{
+					map[string]interface{}{"name": "a", "port": 1.0}, map[string]interface{}{"name": "b", "port": 2.0},
+					map[string]interface{}{"name": "b", "port": 3.0}, map[string]interface{}{"name": "c", "port": 4.0},
+				},
+				"tags": []interface{}{"x", "y"},
+			},
+		},
+		{
+			name: "annotation",
+			opts: Options{Values: []string{"base.yaml", "annotated.yaml"}}, // nolint
+			want: Context{
+				"name": "prod",
+				"servers": []interface{}{
+					map[string]interface{}{"name": "a", "port": 1.0}, map[string]interface{}{"name": "b", "port": 3.0},
+					map[string]interface{}{"name": "c", "port": 4.0},
+				},
+				"tags": []interface{}{"x"},
+			},
+		},
+		{
+			name: "annotation of the file only",
+			opts: Options{Values: []string{"annotated.yaml", "base.yaml"}}, // nolint
+			want: Context{
+				"name":    "prod",
+				"servers": []interface{}{map[string]interface{}{"name": "b", "port": 3.0}, map[string]interface{}{"name": "c", "port": 4.0}}, // nolint:lll
+				"tags":    []interface{}{"x"},
+			},
+		},
+		{
+			name: "set wins and deletes",
+			opts: Options{ // nolint
+				Values: []string{"base.yaml"}, MergeNulls: NullsDelete,
+				Define: map[string]string{"debug": "null", "name": "cli"},
+			},
+			want: Context{
+				"name":    "cli",
+				"servers": []interface{}{map[string]interface{}{"name": "a", "port": 1.0}, map[string]interface{}{"name": "b", "port": 2.0}}, // nolint:lll
+				"tags":    []interface{}{"x"},
+			},
+		},
+		{name: "bad flag", opts: Options{Merge: "first"}, wantErr: true},                     // nolint
+		{name: "bad annotation", opts: Options{Values: []string{"bad.yaml"}}, wantErr: true}, // nolint
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			o := tt.opts
+			o.FS = fsys
+
+			c, err := new(generator).newContext("", &o)
+
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidMerge))
+
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, c["Values"])
+		})
+	}
+}
+
+func TestGenerator_newContext_inheritMerge(t *testing.T) {
+	t.Parallel()
+
+	o := &Options{ // nolint
+		FS: fstest.MapFS{
+			"values/base.yaml": {Data: []byte("name: base\nregion: none\n")},
+			"values/prod.yaml": {Data: []byte("name: prod\n")},
+			"extra.yaml":       {Data: []byte("name: extra\nregion: eu\n")},
+		},
+		Values:  []string{"values/{{.Env}}.yaml", "extra.yaml"},
+		Inherit: map[string]string{"prod": "base"},
+	}
+
+	c, err := new(generator).newContext("prod", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "prod", "region": "none"}, c["Values"])
+
+	o.Merge = MergeOverride
+
+	c, err = new(generator).newContext("prod", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "extra", "region": "eu"}, c["Values"])
+}
+
+func TestGenerator_newContext_mergeSchema(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"values.yaml":        {Data: []byte("$schema: values.schema.json\n$merge: {strategy: override}\nname: app\n")},
+		"values.schema.json": {Data: []byte(`{"type":"object","properties":{"$schema":{},"name":{}},"additionalProperties":false}`)},
+	}
+
+	o := &Options{FS: fsys, Values: []string{"values.yaml"}} // nolint
+
+	c, err := (&generator{fsys: fsys}).newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "app", c["Values"].(Context)["name"])
+
+	fsys["values.yaml"] = &fstest.MapFile{Data: []byte("$schema: values.schema.json\nname: app\nother: 1\n")}
+
+	_, err = (&generator{fsys: fsys}).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrValidationError))
+}
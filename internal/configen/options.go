@@ -22,17 +22,156 @@
 
 package configen
 
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+)
+
 // Options holds command line flags.
 type Options struct {
-	Templates []string          `short:"t" long:"template" value-name:"directory" description:"Input directory [arg: directory] (default: templates)"` //nolint:lll
-	Raws      []string          `short:"r" long:"raw" value-name:"directory" description:"Raw input directory to copy (default: static)"`              //nolint:lll
-	Output    string            `short:"o" long:"output" value-name:"directory" description:"Output directory (default: dist)"`                        //nolint:lll
-	Schemas   []string          `short:"s" long:"schema" value-name:"directory" description:"Schema directory (default: schemas)"`                     //nolint:lll
-	Values    []string          `short:"f" long:"values" value-name:"file" description:"Data values file [arg: +file] (default: values.yaml)"`         //nolint:lll
-	Define    map[string]string `long:"set" value-name:"name:value" description:"Set value [arg: name=value]"`                                         //nolint:lll
-	Loose     bool              `long:"loose" description:"Disable schema validation"`
-	Dry       bool              `long:"dry-run" description:"Skip writing output files"`
-	Dump      bool              `long:"dump" description:"Dump intermediate files"`
-	Quiet     bool              `short:"q" long:"quiet" description:"Suppress console output"`
-	Package   string            `short:"p" long:"package" value-name:"file" description:"Package descriptor template (default: package.json)"` //nolint:lll
+	Templates       []string          `short:"t" long:"template" value-name:"directory" description:"Input directory [arg: directory] (default: templates)"`                                                                        //nolint:lll
+	Raws            []string          `short:"r" long:"raw" value-name:"directory" description:"Raw input directory to copy (default: static)"`                                                                                     //nolint:lll
+	Output          string            `short:"o" long:"output" value-name:"directory" description:"Output directory (default: dist)"`                                                                                               //nolint:lll
+	Schemas         []string          `short:"s" long:"schema" value-name:"directory" description:"Schema directory (default: schemas)"`                                                                                            //nolint:lll
+	Values          []string          `short:"f" long:"values" value-name:"file" description:"Data values file, directory, URL or source (https://..., env:PREFIX, exec:command, - for stdin) [arg: +file] (default: values.yaml)"` //nolint:lll
+	ValuesFormat    string            `long:"values-format" value-name:"format" description:"Format of values read from stdin (-f -) or command output (default: yaml)"`                                                            //nolint:lll
+	ValuesDirKeys   bool              `long:"values-dir-keys" description:"Place values of files in values directories under their path (db/primary.yaml: db.primary)"`                                                             //nolint:lll
+	NoValuesDirKeys bool              `long:"no-values-dir-keys" description:"Do not place values of files in values directories under their path (overrides the project file)"`                                                    //nolint:lll
+	ValuesCache     string            `long:"values-cache" value-name:"directory" description:"Cache directory of remote (https://) values files (default: user cache directory)"`                                                  //nolint:lll
+	ExecTimeout     time.Duration     `long:"exec-timeout" value-name:"duration" description:"Kill commands of exec: values sources after the timeout (default: 1m)"`                                                               //nolint:lll
+	AgeKeyFile      string            `long:"age-key" value-name:"file" description:"Age identity file decrypting encrypted values files (default: $SOPS_AGE_KEY_FILE or $SOPS_AGE_KEY)"`                                           //nolint:lll
+	Secrets         string            `long:"secrets" value-name:"provider" description:"Secret provider of the secret template function: file:path or vault:mount (using $VAULT_ADDR and $VAULT_TOKEN)"`                           //nolint:lll
+	SecretsAudit    string            `long:"secrets-audit" value-name:"file" description:"Append audit log of secret lookups to the file (JSON lines, without values)"`                                                            //nolint:lll
+	Define          map[string]string `long:"set" value-name:"name:value" description:"Set value, name may be a path like a.b[0].c, type inferred as YAML scalar [arg: name=value]"`                                                //nolint:lll
+	DefineString    map[string]string `long:"set-string" value-name:"name:value" description:"Set string value"`                                                                                                                    //nolint:lll
+	DefineJSON      map[string]string `long:"set-json" value-name:"name:json" description:"Set JSON value"`                                                                                                                         //nolint:lll
+	DefineFile      map[string]string `long:"set-file" value-name:"name:file" description:"Set value to the content of the file"`                                                                                                   //nolint:lll
+	Axes            []string          `long:"axis" value-name:"name=value,..." description:"Generate for every value of the dimension (matrix)"`                                                                                    //nolint:lll
+	AxisExclude     []string          `long:"axis-exclude" value-name:"name=value,..." description:"Skip matching combinations of dimensions (env matches the environment)"`                                                        //nolint:lll
+	Merge           string            `long:"merge" value-name:"strategy" description:"Merge values files: keep-first or override (default: keep-first)"`                                                                           //nolint:lll
+	MergeLists      string            `long:"merge-lists" value-name:"mode" description:"Merge lists of values files: replace, append or merge:field (default: replace)"`                                                           //nolint:lll
+	MergeNulls      string            `long:"merge-nulls" value-name:"mode" description:"Null in values files: ignore or delete the key (default: ignore)"`                                                                         //nolint:lll
+	Loose           bool              `long:"loose" description:"Disable schema validation"`
+	NoLoose         bool              `long:"no-loose" description:"Enable schema validation (overrides the project file)"`
+	Dry             bool              `long:"dry-run" description:"Skip writing output files"`
+	Dump            bool              `long:"dump" description:"Dump intermediate files"`
+	NoDump          bool              `long:"no-dump" description:"Do not dump intermediate files (overrides the project file)"`
+	Quiet           bool              `short:"q" long:"quiet" description:"Suppress console output"`
+	NoQuiet         bool              `long:"no-quiet" description:"Do not suppress console output (overrides the project file)"`
+	Package         string            `short:"p" long:"package" value-name:"file" description:"Package descriptor template (default: package.json)"` //nolint:lll
+	KeepGoing       bool              `short:"k" long:"keep-going" description:"Continue after errors and report all of them"`
+	NoKeepGoing     bool              `long:"no-keep-going" description:"Stop at the first error (overrides the project file)"`
+	Jobs            int               `short:"j" long:"jobs" value-name:"number" description:"Number of files generated in parallel (default: 1)"` //nolint:lll
+	Prune           bool              `long:"prune" description:"Remove files not generated by this run from the output directory"`
+	NoPrune         bool              `long:"no-prune" description:"Do not remove files not generated by this run (overrides the project file)"`                                                            //nolint:lll
+	PruneIgnore     []string          `long:"prune-ignore" value-name:"pattern" description:"Glob pattern of files to keep when pruning"`                                                                   //nolint:lll
+	Atomic          bool              `long:"atomic" description:"Fail if output directories can not be staged and replaced as a whole"`                                                                    //nolint:lll
+	NoAtomic        bool              `long:"no-atomic" description:"Write output files in place, not into staging directories replacing the output directories"`                                           //nolint:lll
+	Since           string            `long:"since" value-name:"revision" description:"Regenerate only outputs affected by changes since the git revision (requires --manifest)"`                           //nolint:lll
+	Debounce        time.Duration     `long:"debounce" value-name:"duration" description:"Wait for changes to settle before generating in watch mode (default: 100ms)"`                                     //nolint:lll
+	Manifest        string            `long:"manifest" value-name:"file" optional:"yes" optional-value:".configen-manifest.json" description:"Write manifest of generated files into the output directory"` //nolint:lll
+
+	Stdin  io.Reader  `no-flag:"true"` // values read by -f - (default: os.Stdin), read once per run (once in watch and serve mode)
+	Stdout io.Writer  `no-flag:"true"` // console output of templates (default: os.Stdout)
+	Stderr io.Writer  `no-flag:"true"` // diagnostic output (default: os.Stderr)
+	FS     fs.FS      `no-flag:"true"` // input file system (default: the operating system's file system)
+	Sink   OutputSink `no-flag:"true"` // receiver of output files (default: DirSink)
+
+	// HTTPClient fetches remote (https://) values files (default: a client with 30s timeout).
+	HTTPClient *http.Client `no-flag:"true"`
+
+	// SecretProvider looks up secrets of the secret template function (default: given by Secrets).
+	// Lookups are cached during a run and logged to Audit (default: the file given by SecretsAudit).
+	SecretProvider SecretProvider `no-flag:"true"`
+	Audit          io.Writer      `no-flag:"true"`
+
+	// Previous holds the report of a previous run. If set, only outputs depending on the Changed
+	// input files (or failed in the previous run) are regenerated, others are taken from Previous.
+	Previous *Report  `no-flag:"true"`
+	Changed  []string `no-flag:"true"`
+
+	// Inherit maps environments to their parent environments. Values files, template and raw directories
+	// are layered along the inheritance chain, the more specific environment taking precedence.
+	Inherit map[string]string `no-flag:"true"`
+
+	// Overrides holds values taking precedence over values files and Define (used by the render API).
+	Overrides map[string]interface{} `no-flag:"true"`
+
+	// Environ holds environment variables visible for templates (through env and expandenv functions)
+	// in addition to the process environment. It allows setting variables without affecting concurrent runs.
+	Environ map[string]string `no-flag:"true"`
+}
+
+func (o *Options) fsys() fs.FS {
+	if o.FS != nil {
+		return o.FS
+	}
+
+	return osFS{}
+}
+
+func (o *Options) sink() OutputSink {
+	if o.Sink != nil {
+		return o.Sink
+	}
+
+	return DirSink{}
+}
+
+// defaultValuesFormat is the format of values read from stdin or command output; it parses JSON too.
+const defaultValuesFormat = "yaml"
+
+func (o *Options) valuesFormat() string {
+	if len(o.ValuesFormat) != 0 {
+		return o.ValuesFormat
+	}
+
+	return defaultValuesFormat
+}
+
+// defaultExecTimeout is the timeout of commands of exec: values sources.
+const defaultExecTimeout = time.Minute
+
+func (o *Options) execTimeout() time.Duration {
+	if o.ExecTimeout > 0 {
+		return o.ExecTimeout
+	}
+
+	return defaultExecTimeout
+}
+
+func (o *Options) stdin() io.Reader {
+	if o.Stdin != nil {
+		return o.Stdin
+	}
+
+	return os.Stdin
+}
+
+func (o *Options) stdout() io.Writer {
+	if o.Stdout != nil {
+		return o.Stdout
+	}
+
+	return os.Stdout
+}
+
+func (o *Options) stderr() io.Writer {
+	if o.Stderr != nil {
+		return o.Stderr
+	}
+
+	return os.Stderr
+}
+
+// getenv returns the environment variable from Environ or the process environment.
+func (o *Options) getenv(key string) string {
+	if val, ok := o.Environ[key]; ok {
+		return val
+	}
+
+	return os.Getenv(key)
 }
@@ -0,0 +1,320 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	_ "embed" // nolint
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ProjectSchema is the JSON schema of project files.
+//
+//go:embed configen.schema.json
+var ProjectSchema []byte
+
+// ProjectFiles are the names of project files looked up in the working directory, in order of preference.
+var ProjectFiles = []string{"configen.yaml", "configen.yml", "configen.toml", "configen.json"}
+
+// Project holds the settings of a project file. Command line flags override the settings.
+type Project struct {
+	Templates    []string               `json:"templates,omitempty"`
+	Raws         []string               `json:"raws,omitempty"`
+	Schemas      []string               `json:"schemas,omitempty"`
+	Values       []string               `json:"values,omitempty"`
+	Output       string                 `json:"output,omitempty"`
+	Package      string                 `json:"package,omitempty"`
+	Environments map[string]*ProjectEnv `json:"environments,omitempty"`
+	Axes         map[string][]string    `json:"axes,omitempty"`
+	AxisExclude  []map[string]string    `json:"axisExclude,omitempty"`
+	Defaults     ProjectDefaults        `json:"defaults,omitempty"`
+}
+
+// ProjectEnv describes an environment of the project.
+type ProjectEnv struct {
+	Parent   string `json:"parent,omitempty"`
+	Abstract bool   `json:"abstract,omitempty"` // only used as a parent, not generated by default
+}
+
+// ProjectDefaults holds default values of command line flags.
+type ProjectDefaults struct {
+	Set           map[string]string `json:"set,omitempty"`
+	Loose         bool              `json:"loose,omitempty"`
+	Dump          bool              `json:"dump,omitempty"`
+	Quiet         bool              `json:"quiet,omitempty"`
+	KeepGoing     bool              `json:"keepGoing,omitempty"`
+	Jobs          int               `json:"jobs,omitempty"`
+	Prune         bool              `json:"prune,omitempty"`
+	PruneIgnore   []string          `json:"pruneIgnore,omitempty"`
+	Atomic        bool              `json:"atomic,omitempty"`
+	Manifest      string            `json:"manifest,omitempty"`
+	Merge         string            `json:"merge,omitempty"`
+	MergeLists    string            `json:"mergeLists,omitempty"`
+	MergeNulls    string            `json:"mergeNulls,omitempty"`
+	ValuesFormat  string            `json:"valuesFormat,omitempty"`
+	ValuesDirKeys bool              `json:"valuesDirKeys,omitempty"`
+}
+
+// FindProject returns the name of the project file in dir, or an empty string if there is none.
+func FindProject(dir string) string {
+	for _, name := range ProjectFiles {
+		path := filepath.Join(dir, name)
+
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// LoadProject reads the project file and validates it against ProjectSchema.
+// Relative paths of the project are resolved against the directory of the project file.
+func LoadProject(path string) (*Project, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := Parse(b, formatOf(path))
+	if err != nil {
+		return nil, wrap(err, path)
+	}
+
+	if err := validateProject(doc); err != nil {
+		return nil, wrap(err, path)
+	}
+
+	// the document is valid, so it can be decoded through JSON
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return nil, wrap(err, path)
+	}
+
+	p := new(Project)
+
+	if err := json.Unmarshal(js, p); err != nil {
+		return nil, wrap(err, path)
+	}
+
+	p.relativeTo(filepath.Dir(path))
+
+	return p, nil
+}
+
+func validateProject(doc Context) error {
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(ProjectSchema), gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return err
+	}
+
+	if result.Valid() {
+		return nil
+	}
+
+	var buff bytes.Buffer
+
+	for i, desc := range result.Errors() {
+		if i != 0 {
+			buff.WriteRune(';')
+		}
+
+		buff.WriteString(desc.String())
+	}
+
+	return fmt.Errorf("%w: %s", ErrValidationError, buff.String())
+}
+
+func (p *Project) relativeTo(dir string) {
+	if dir == "." {
+		return
+	}
+
+	join := func(path string) string {
+		if len(path) == 0 || filepath.IsAbs(path) {
+			return path
+		}
+
+		return filepath.Join(dir, path)
+	}
+
+	for _, paths := range [][]string{p.Templates, p.Raws, p.Schemas, p.Values} {
+		for i := range paths {
+			paths[i] = join(paths[i])
+		}
+	}
+
+	p.Output = join(p.Output)
+	p.Package = join(p.Package)
+}
+
+// Envs returns the sorted names of the environments generated by default (the not abstract ones).
+func (p *Project) Envs() []string {
+	envs := []string{}
+
+	for name, env := range p.Environments {
+		if env == nil || !env.Abstract {
+			envs = append(envs, name)
+		}
+	}
+
+	sort.Strings(envs)
+
+	return envs
+}
+
+// Apply sets the options not given (empty) from the project.
+func (p *Project) Apply(opts *Options) {
+	p.applyPaths(opts)
+
+	for name, env := range p.Environments {
+		if env == nil || len(env.Parent) == 0 {
+			continue
+		}
+
+		if opts.Inherit == nil {
+			opts.Inherit = make(map[string]string)
+		}
+
+		if _, ok := opts.Inherit[name]; !ok {
+			opts.Inherit[name] = env.Parent
+		}
+	}
+
+	if len(opts.Axes) == 0 {
+		names := make([]string, 0, len(p.Axes))
+
+		for name := range p.Axes {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			opts.Axes = append(opts.Axes, name+"="+strings.Join(p.Axes[name], ","))
+		}
+	}
+
+	if len(opts.AxisExclude) == 0 {
+		for _, exclude := range p.AxisExclude {
+			pairs := make([]string, 0, len(exclude))
+
+			for name, value := range exclude {
+				pairs = append(pairs, name+"="+value)
+			}
+
+			sort.Strings(pairs)
+
+			opts.AxisExclude = append(opts.AxisExclude, strings.Join(pairs, ","))
+		}
+	}
+
+	p.Defaults.apply(opts)
+}
+
+func (p *Project) applyPaths(opts *Options) {
+	if len(opts.Templates) == 0 {
+		opts.Templates = p.Templates
+	}
+
+	if len(opts.Raws) == 0 {
+		opts.Raws = p.Raws
+	}
+
+	if len(opts.Schemas) == 0 {
+		opts.Schemas = p.Schemas
+	}
+
+	if len(opts.Values) == 0 {
+		opts.Values = p.Values
+	}
+
+	if len(opts.Output) == 0 {
+		opts.Output = p.Output
+	}
+
+	if len(opts.Package) == 0 {
+		opts.Package = p.Package
+	}
+}
+
+func (d *ProjectDefaults) apply(opts *Options) {
+	for name, value := range d.Set {
+		if opts.Define == nil {
+			opts.Define = make(map[string]string)
+		}
+
+		if _, ok := opts.Define[name]; !ok {
+			opts.Define[name] = value
+		}
+	}
+
+	opts.Loose = flagDefault(opts.Loose, opts.NoLoose, d.Loose)
+	opts.Dump = flagDefault(opts.Dump, opts.NoDump, d.Dump)
+	opts.Quiet = flagDefault(opts.Quiet, opts.NoQuiet, d.Quiet)
+	opts.KeepGoing = flagDefault(opts.KeepGoing, opts.NoKeepGoing, d.KeepGoing)
+	opts.Prune = flagDefault(opts.Prune, opts.NoPrune, d.Prune)
+	opts.Atomic = flagDefault(opts.Atomic, opts.NoAtomic, d.Atomic)
+	opts.ValuesDirKeys = flagDefault(opts.ValuesDirKeys, opts.NoValuesDirKeys, d.ValuesDirKeys)
+
+	if opts.Jobs == 0 {
+		opts.Jobs = d.Jobs
+	}
+
+	if len(opts.PruneIgnore) == 0 {
+		opts.PruneIgnore = d.PruneIgnore
+	}
+
+	if len(opts.Manifest) == 0 {
+		opts.Manifest = d.Manifest
+	}
+
+	if len(opts.Merge) == 0 {
+		opts.Merge = d.Merge
+	}
+
+	if len(opts.MergeLists) == 0 {
+		opts.MergeLists = d.MergeLists
+	}
+
+	if len(opts.MergeNulls) == 0 {
+		opts.MergeNulls = d.MergeNulls
+	}
+
+	if len(opts.ValuesFormat) == 0 {
+		opts.ValuesFormat = d.ValuesFormat
+	}
+}
+
+// flagDefault returns the value of a boolean flag defaulting to the project setting.
+// Boolean flags can only be turned on, so the setting is turned off by the negated (--no-*) flag.
+func flagDefault(flag, negated, project bool) bool {
+	return !negated && (flag || project)
+}
@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestLoadProject(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	assert.Equal(t, "", configen.FindProject(dir))
+
+	project := `
+templates: [templates]
+values: [values/base.yaml, /etc/values.yaml]
+output: dist/{{.Env}}
+environments:
+  base:
+    abstract: true
+  prod:
+    parent: base
+  dev:
+axes:
+  region: [eu, us]
+axisExclude:
+  - {region: us, env: dev}
+defaults:
+  set: {replicas: "1"}
+  keepGoing: true
+  jobs: 4
+  merge: override
+  prune: true
+  loose: true
+`
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "configen.yaml"), []byte(project), 0o600))
+
+	path := configen.FindProject(dir)
+
+	assert.Equal(t, filepath.Join(dir, "configen.yaml"), path)
+
+	p, err := configen.LoadProject(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "templates")}, p.Templates)
+	assert.Equal(t, []string{filepath.Join(dir, "values", "base.yaml"), "/etc/values.yaml"}, p.Values)
+	assert.Equal(t, filepath.Join(dir, "dist", "{{.Env}}"), p.Output)
+	assert.Equal(t, []string{"dev", "prod"}, p.Envs())
+
+	opts := &configen.Options{ // nolint
+		Templates: []string{"tpl"},
+		Define:    map[string]string{"replicas": "3"},
+		Jobs:      2,
+		NoPrune:   true,
+	}
+
+	p.Apply(opts)
+
+	assert.Equal(t, []string{"tpl"}, opts.Templates)
+	assert.Equal(t, p.Values, opts.Values)
+	assert.Equal(t, p.Output, opts.Output)
+	assert.Equal(t, map[string]string{"replicas": "3"}, opts.Define)
+	assert.Equal(t, map[string]string{"prod": "base"}, opts.Inherit)
+	assert.Equal(t, []string{"region=eu,us"}, opts.Axes)
+	assert.Equal(t, []string{"env=dev,region=us"}, opts.AxisExclude)
+	assert.True(t, opts.KeepGoing)
+	assert.True(t, opts.Loose)
+	assert.False(t, opts.Prune, "turned off by the negated flag")
+	assert.Equal(t, 2, opts.Jobs)
+	assert.Equal(t, configen.MergeOverride, opts.Merge)
+}
+
+func TestLoadProject_invalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "configen.json", content: `{"templates": "templates"}`},
+		{name: "configen.toml", content: "unknown = true\n"},
+		{name: "configen.yml", content: "defaults:\n  jobs: 0\n"},
+		{name: "merge.yaml", content: "defaults:\n  mergeLists: prepend\n"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+
+		assert.Nil(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+		_, err := configen.LoadProject(path)
+
+		assert.True(t, errors.Is(err, configen.ErrValidationError), tt.name)
+	}
+}
@@ -0,0 +1,212 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ErrUnsafePrune returned when pruning would remove files of the working directory or its parents.
+var ErrUnsafePrune = errors.New("refusing to prune")
+
+// prune removes files from the output directories which were not produced by the run described by report,
+// and the directories became empty. Files matching opts.PruneIgnore patterns (relative to the output directory)
+// are kept. In dry-run mode nothing is removed. The removed files are returned.
+// Nothing is pruned if output files are not written to the disk (like with MemorySink or TarSink).
+func prune(report *Report, opts *Options, envs []string) ([]string, error) {
+	switch opts.sink().(type) {
+	case DirSink, *stage:
+	default:
+		return []string{}, nil
+	}
+
+	keep, err := compileGlobs(opts.PruneIgnore)
+	if err != nil {
+		return nil, err
+	}
+
+	produced := make(map[string]bool)
+
+	for _, file := range report.Files {
+		produced[filepath.Clean(file.Path)] = true
+
+		if len(file.Dump) != 0 {
+			produced[filepath.Clean(file.Dump)] = true
+		}
+	}
+
+	dirs, err := outputDirs(opts, envs)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []string{}
+
+	for _, dir := range dirs {
+		if err := checkPruneDir(dir); err != nil {
+			return pruned, err
+		}
+
+		stale, err := findStale(dir, produced, keep)
+		if err != nil {
+			return pruned, err
+		}
+
+		for _, path := range stale {
+			if !opts.Dry {
+				if err := os.Remove(path); err != nil {
+					return pruned, err
+				}
+			}
+
+			pruned = append(pruned, path)
+		}
+
+		if !opts.Dry {
+			if err := removeEmptyDirs(dir); err != nil {
+				return pruned, err
+			}
+		}
+	}
+
+	return pruned, nil
+}
+
+func findStale(dir string, produced map[string]bool, keep []glob.Glob) ([]string, error) {
+	stale := []string{}
+
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() || produced[path] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		for _, g := range keep {
+			if g.Match(filepath.ToSlash(rel)) {
+				return nil
+			}
+		}
+
+		stale = append(stale, path)
+
+		return nil
+	})
+
+	return stale, err
+}
+
+// removeEmptyDirs removes empty subdirectories of dir.
+func removeEmptyDirs(dir string) error {
+	dirs := []string{}
+
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() && path != dir {
+			dirs = append(dirs, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// deepest first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			if err := os.Remove(d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPruneDir refuses pruning the working directory, its parents and the root directory.
+func checkPruneDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	if abs == wd || abs == filepath.Dir(abs) || strings.HasPrefix(wd, abs+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is not a dedicated output directory", ErrUnsafePrune, dir)
+	}
+
+	return nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(patterns))
+
+	for _, p := range patterns {
+		g, err := glob.Compile(p, '/')
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+
+		globs = append(globs, g)
+	}
+
+	return globs, nil
+}
@@ -0,0 +1,130 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_prune(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+
+	for _, name := range []string{"stale.txt", "old/stale.txt", ".keep/file"} {
+		path := filepath.Join(out, "dev", name)
+
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(name), 0600))
+	}
+
+	// placeholder created by earlier versions
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(out, "dev", "index.html"), []byte("<html></html>"), 0600))
+
+	opts := &configen.Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/foo.txt": {Data: []byte("foo\n")},
+		},
+		Templates:   []string{"templates"},
+		Output:      filepath.Join(out, "{{.Env}}"),
+		Define:      map[string]string{},
+		Prune:       true,
+		PruneIgnore: []string{".keep/**"},
+		Dry:         true,
+	}
+
+	stale := []string{
+		filepath.Join(out, "dev", "index.html"), filepath.Join(out, "dev", "old", "stale.txt"), filepath.Join(out, "dev", "stale.txt"),
+	}
+
+	report, err := configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assert.Equal(t, stale, report.Pruned)
+	assert.FileExists(t, stale[1])
+
+	opts.Dry = false
+
+	report, err = configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assert.Equal(t, stale, report.Pruned)
+	assert.FileExists(t, filepath.Join(out, "dev", "foo.txt"))
+	assert.FileExists(t, filepath.Join(out, "dev", ".keep", "file"))
+	assert.NoFileExists(t, stale[0])
+	assert.NoFileExists(t, stale[2])
+	assert.NoDirExists(t, filepath.Join(out, "dev", "old"))
+}
+
+func TestRender_pruneUnsafe(t *testing.T) {
+	t.Parallel()
+
+	opts := &configen.Options{ // nolint
+		FS:        fstest.MapFS{"templates/foo.txt": {Data: []byte("foo\n")}},
+		Templates: []string{"templates"},
+		Output:    ".",
+		Define:    map[string]string{},
+		Prune:     true,
+		Dry:       true,
+	}
+
+	_, err := configen.Render(opts, "")
+
+	assert.True(t, errors.Is(err, configen.ErrUnsafePrune))
+}
+
+func TestRender_pruneMemorySink(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	existing := filepath.Join(out, "dev", "existing.txt")
+
+	assert.Nil(t, os.MkdirAll(filepath.Dir(existing), 0755))
+	assert.Nil(t, ioutil.WriteFile(existing, []byte("existing"), 0600))
+
+	sink := configen.NewMemorySink()
+
+	opts := &configen.Options{ // nolint
+		FS:        fstest.MapFS{"templates/foo.txt": {Data: []byte("foo\n")}},
+		Templates: []string{"templates"},
+		Output:    filepath.Join(out, "{{.Env}}"),
+		Define:    map[string]string{},
+		Prune:     true,
+		Sink:      sink,
+	}
+
+	report, err := configen.Render(opts, "dev")
+
+	assert.Nil(t, err)
+	assert.Empty(t, report.Pruned)
+	assert.FileExists(t, existing)
+	assert.Contains(t, sink.Files(), filepath.ToSlash(filepath.Join(out, "dev", "foo.txt")))
+}
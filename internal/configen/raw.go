@@ -22,14 +22,62 @@
 
 package configen
 
-import "github.com/otiai10/copy"
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
 
-func (g *generator) copy() error {
-	for _, dir := range g.raws {
-		if err := copy.Copy(dir, g.output); err != nil {
+// copy copies the files of the raw directories. Symbolic links to files are copied as regular files
+// with the content of their target, other symbolic links and special files are reported and skipped.
+func (g *generator) copy(j *job) error {
+	for _, layers := range g.raws {
+		err := walkLayers(g.fsys, layers, func(dir, rel string, entry fs.DirEntry) error {
+			src, out := filepath.Join(dir, rel), filepath.Join(g.output, rel)
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if info, err = fs.Stat(g.fsys, src); err != nil {
+					fmt.Fprintf(g.stderr, "warning: %s: broken symbolic link, not copied\n", src)
+
+					return nil
+				}
+			}
+
+			if !info.Mode().IsRegular() {
+				fmt.Fprintf(g.stderr, "warning: %s: not a regular file, not copied\n", src)
+
+				return nil
+			}
+
+			return g.copyFile(j, src, out, info.Mode().Perm())
+		})
+		if err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+func (g *generator) copyFile(j *job, src string, out string, perm fs.FileMode) error {
+	b, err := fs.ReadFile(g.fsys, src)
+	if err != nil {
+		return wrap(err, src)
+	}
+
+	file := &FileReport{Env: g.env, Dims: g.dims, Source: src, Path: out, Format: formatOf(out)}
+
+	file.digest(b)
+	j.report.add(file)
+
+	if g.dry {
+		return nil
+	}
+
+	return g.sink.WriteFile(out, b, perm)
+}
@@ -0,0 +1,73 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestRender_rawSymlinks(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges")
+	}
+
+	dir := t.TempDir()
+	static := filepath.Join(dir, "static")
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(static, "sub"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "shared.txt"), []byte("shared\n"), 0o600))
+	assert.Nil(t, os.Symlink(filepath.Join("..", "shared.txt"), filepath.Join(static, "link.txt")))
+	assert.Nil(t, os.Symlink("missing.txt", filepath.Join(static, "broken.txt")))
+	assert.Nil(t, os.Symlink("sub", filepath.Join(static, "dir")))
+
+	var stderr bytes.Buffer
+
+	sink := configen.NewMemorySink()
+
+	opts := &configen.Options{ // nolint
+		FS:     os.DirFS(dir),
+		Raws:   []string{"static"},
+		Output: "dist",
+		Define: map[string]string{},
+		Quiet:  true,
+		Stderr: &stderr,
+		Sink:   sink,
+	}
+
+	report, err := configen.Render(opts, "")
+
+	assert.Nil(t, err)
+	assert.Len(t, report.Files, 1)
+	assert.Equal(t, map[string][]byte{"dist/link.txt": []byte("shared\n")}, sink.Files())
+	assert.Contains(t, stderr.String(), "static/broken.txt: broken symbolic link")
+	assert.Contains(t, stderr.String(), "static/dir: not a regular file")
+}
@@ -0,0 +1,197 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	eventsPath = "/_configen/events"
+
+	eventRegenerated = "regenerated"
+	eventFailed      = "failed"
+)
+
+// reloadScript is injected into served HTML pages. It reloads the page after each generation
+// (failed generations show the error overlay).
+const reloadScript = `<script>(function(){` +
+	`var es=new EventSource("` + eventsPath + `");` +
+	`es.addEventListener("` + eventRegenerated + `",function(){location.reload()});` +
+	`es.addEventListener("` + eventFailed + `",function(){location.reload()});` +
+	`})();</script>`
+
+// broadcaster pushes generation events to the connected browsers using Server-Sent Events.
+type broadcaster struct {
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{clients: make(map[chan string]bool)}
+}
+
+func (b *broadcaster) subscribe() chan string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan string, 1)
+
+	b.clients[ch] = true
+
+	return ch
+}
+
+func (b *broadcaster) unsubscribe(ch chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.clients, ch)
+}
+
+// publish sends the event to all clients. Clients not consumed the previous event yet miss the event.
+func (b *broadcaster) publish(event string, data string) {
+	var buff bytes.Buffer
+
+	fmt.Fprintf(&buff, "event: %s\n", event)
+
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&buff, "data: %s\n", line)
+	}
+
+	buff.WriteByte('\n')
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.clients {
+		select {
+		case ch <- buff.String():
+		default:
+		}
+	}
+}
+
+func (b *broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+
+		return
+	}
+
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			if _, err := w.Write([]byte(msg)); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// injectReload serves HTML pages of dir with the reload script (and the snippet returned by extra,
+// if not nil) injected, other requests are passed to next.
+func injectReload(dir http.FileSystem, next http.Handler, extra func() string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+
+		if r.Method != http.MethodGet || path.Ext(name) != ".html" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		f, err := dir.Open(name)
+		if err != nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		defer f.Close()
+
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(injectScript(b, pageScript(extra))) // nolint
+	})
+}
+
+// pageScript returns the snippet injected into served pages.
+func pageScript(extra func() string) string {
+	if extra != nil {
+		return extra() + reloadScript
+	}
+
+	return reloadScript
+}
+
+// injectScript inserts script before the closing body (or html) tag of page, or appends it.
+func injectScript(page []byte, script string) []byte {
+	lower := bytes.ToLower(page)
+
+	idx := bytes.LastIndex(lower, []byte("</body>"))
+	if idx < 0 {
+		idx = bytes.LastIndex(lower, []byte("</html>"))
+	}
+
+	if idx < 0 {
+		return append(page, script...)
+	}
+
+	out := make([]byte, 0, len(page)+len(script))
+
+	out = append(out, page[:idx]...)
+	out = append(out, script...)
+
+	return append(out, page[idx:]...)
+}
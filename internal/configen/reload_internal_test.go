@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectScript(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{name: "body", page: "<html><body>x</body></html>", want: "<html><body>x<s></body></html>"},
+		{name: "upper", page: "<HTML><BODY>x</BODY></HTML>", want: "<HTML><BODY>x<s></BODY></HTML>"},
+		{name: "html", page: "<html></html>", want: "<html><s></html>"},
+		{name: "fragment", page: "<p>x</p>", want: "<p>x</p><s>"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, string(injectScript([]byte(tt.page), "<s>")))
+		})
+	}
+}
+
+func TestInjectReload(t *testing.T) {
+	t.Parallel()
+
+	dir := http.FS(fstest.MapFS{
+		"index.html":     {Data: []byte("<html></html>")},
+		"sub/page.html":  {Data: []byte("<body></body>")},
+		"sub/index.html": {Data: []byte("<html></html>")},
+		"data.json":      {Data: []byte("{}")},
+	})
+
+	srv := httptest.NewServer(injectReload(dir, http.FileServer(dir), nil))
+	defer srv.Close()
+
+	tests := []struct {
+		path   string
+		inject bool
+	}{
+		{path: "/", inject: true},
+		{path: "/sub/page.html", inject: true},
+		{path: "/sub/", inject: true},
+		{path: "/data.json", inject: false},
+	}
+
+	for _, tt := range tests {
+		res, err := http.Get(srv.URL + tt.path) // nolint
+
+		assert.Nil(t, err)
+
+		b, err := ioutil.ReadAll(res.Body)
+
+		res.Body.Close()
+
+		assert.Nil(t, err)
+		assert.Equal(t, tt.inject, strings.Contains(string(b), eventsPath), tt.path)
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	t.Parallel()
+
+	b := newBroadcaster()
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL) // nolint
+
+	assert.Nil(t, err)
+
+	defer res.Body.Close()
+
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	b.publish(eventFailed, "first\nsecond")
+
+	scanner := bufio.NewScanner(res.Body)
+
+	lines := []string{}
+
+	for len(lines) < 3 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	assert.Equal(t, []string{"event: failed", "data: first", "data: second"}, lines)
+}
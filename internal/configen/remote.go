@@ -0,0 +1,296 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrIntegrity returned if the content of a remote values file does not match its pinned checksum.
+	ErrIntegrity = errors.New("integrity check failed")
+
+	// ErrInsecureRedirect returned if fetching a remote values file is redirected to a non-https URL.
+	ErrInsecureRedirect = errors.New("redirect to non-https URL")
+)
+
+const (
+	// integrityPrefix is the URL fragment prefix pinning the SHA-256 checksum of the content.
+	integrityPrefix = "sha256="
+
+	remoteTimeout = 30 * time.Second
+	maxRedirects  = 10 // like the default of http.Client
+	cacheDirName  = "configen"
+)
+
+// contentTypes maps media types of remote values files to formats.
+var contentTypes = map[string]string{
+	"application/json":   "json",
+	"text/json":          "json",
+	"application/yaml":   "yaml",
+	"application/x-yaml": "yaml",
+	"text/yaml":          "yaml",
+	"text/x-yaml":        "yaml",
+	"application/toml":   "toml",
+	"text/toml":          "toml",
+}
+
+// remoteEntry is a cached remote values file.
+type remoteEntry struct {
+	URL         string    `json:"url"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Time        time.Time `json:"time"`
+	Body        []byte    `json:"body"`
+}
+
+// httpsValues fetches a values file by HTTPS. The format is given by the content type, the extension
+// of the URL path or Options.ValuesFormat. Responses are cached in Options.ValuesCache and revalidated
+// by ETag; if the server can not be reached, the cached content is used. A #sha256=hex fragment pins
+// the checksum of the content. Redirects are followed to https URLs only.
+func httpsValues(o *Options, arg string) (Context, error) {
+	u, err := url.Parse("https:" + arg)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("%w: bad URL", ErrInvalidSource)
+	}
+
+	pin := ""
+
+	if len(u.Fragment) != 0 {
+		if !strings.HasPrefix(u.Fragment, integrityPrefix) {
+			return nil, fmt.Errorf("%w: unknown fragment %q", ErrInvalidSource, u.Fragment)
+		}
+
+		pin = strings.ToLower(strings.TrimPrefix(u.Fragment, integrityPrefix))
+		u.Fragment = ""
+	}
+
+	entry, err := fetchRemote(o, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pin) != 0 {
+		sum := sha256.Sum256(entry.Body)
+
+		if actual := hex.EncodeToString(sum[:]); actual != pin {
+			return nil, fmt.Errorf("%w: sha256 is %s", ErrIntegrity, actual)
+		}
+	}
+
+	return Parse(entry.Body, remoteFormat(o, entry.ContentType, u.Path))
+}
+
+func remoteFormat(o *Options, contentType string, urlPath string) string {
+	if media, _, err := mime.ParseMediaType(contentType); err == nil {
+		if format, ok := contentTypes[media]; ok {
+			return format
+		}
+	}
+
+	if format := formatOf(path.Base(urlPath)); len(format) != 0 {
+		if _, ok := parsers[format]; ok {
+			return format
+		}
+	}
+
+	return o.valuesFormat()
+}
+
+// fetchRemote returns the content of the URL, from the cache if it has not been changed
+// or the server can not be reached.
+func fetchRemote(o *Options, rawurl string) (*remoteEntry, error) {
+	file, err := o.cacheFile(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := readRemoteEntry(file)
+
+	req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, application/yaml, application/toml;q=0.9, */*;q=0.8")
+
+	if cached != nil && len(cached.ETag) != 0 {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := o.httpClient().Do(req)
+	if errors.Is(err, ErrInsecureRedirect) {
+		return nil, err
+	}
+
+	if err != nil {
+		return offline(o, cached, rawurl, err)
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		return cached, nil
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return offline(o, cached, rawurl, errors.New(resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s", rawurl, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return offline(o, cached, rawurl, err)
+	}
+
+	entry := &remoteEntry{
+		URL:         rawurl,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+		Time:        time.Now(),
+		Body:        body,
+	}
+
+	if err := writeRemoteEntry(file, entry); err != nil {
+		fmt.Fprintf(o.stderr(), "warning: %s: %s\n", rawurl, err)
+	}
+
+	return entry, nil
+}
+
+// offline returns the cached content of the URL (with a warning), or err if it is not cached.
+func offline(o *Options, cached *remoteEntry, rawurl string, err error) (*remoteEntry, error) {
+	if cached == nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(o.stderr(), "warning: %s: %s, using cached values from %s\n", rawurl, err, cached.Time.Format(time.RFC3339))
+
+	return cached, nil
+}
+
+func readRemoteEntry(file string) *remoteEntry {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	entry := new(remoteEntry)
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil
+	}
+
+	return entry
+}
+
+func writeRemoteEntry(file string, entry *remoteEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := mkdir(filepath.Dir(file)); err != nil {
+		return err
+	}
+
+	// written to a temporary file and renamed, so concurrent runs never read a partial entry
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // nolint
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close() // nolint
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// cacheFile returns the name of the cache file of the URL.
+func (o *Options) cacheFile(rawurl string) (string, error) {
+	dir := o.ValuesCache
+
+	if len(dir) == 0 {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(base, cacheDirName, "values")
+	}
+
+	sum := sha256.Sum256([]byte(rawurl))
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// httpClient returns a copy of Options.HTTPClient (or the default client) rejecting redirects to non-https URLs.
+func (o *Options) httpClient() *http.Client {
+	client := &http.Client{Timeout: remoteTimeout}
+
+	if o.HTTPClient != nil {
+		copied := *o.HTTPClient
+		client = &copied
+	}
+
+	check := client.CheckRedirect
+
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("%w: %s", ErrInsecureRedirect, req.URL.Redacted())
+		}
+
+		if check != nil {
+			return check(req, via)
+		}
+
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		return nil
+	}
+
+	return client
+}
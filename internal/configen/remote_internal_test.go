@@ -0,0 +1,189 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_httpsValues(t *testing.T) {
+	t.Parallel()
+
+	var (
+		notMod   int32
+		down     int32
+		document = "name: remote\nreplicas: 3\n"
+	)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/defaults":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"name":"json"}`)) // nolint
+		case "/defaults.toml":
+			w.Write([]byte(`name = "toml"`)) // nolint
+		case "/defaults.yaml":
+			w.Header().Set("ETag", `"v1"`)
+
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notMod, 1)
+				w.WriteHeader(http.StatusNotModified)
+
+				return
+			}
+
+			w.Write([]byte(document)) // nolint
+		case "/moved.yaml":
+			http.Redirect(w, r, "/defaults.yaml", http.StatusFound)
+		case "/insecure.yaml":
+			http.Redirect(w, r, "http://"+r.Host+"/defaults.yaml", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(server.Close)
+
+	var stderr bytes.Buffer
+
+	o := &Options{ // nolint
+		ValuesCache: t.TempDir(),
+		HTTPClient:  server.Client(),
+		Stderr:      &stderr,
+	}
+
+	source, arg, ok := sourceOf(server.URL + "/defaults")
+
+	assert.True(t, ok)
+
+	ctx, err := source(o, arg)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "json"}, ctx, "format by content type")
+
+	ctx, err = httpsValues(o, strings.TrimPrefix(server.URL, "https:")+"/defaults.toml")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "toml"}, ctx, "format by extension")
+
+	url := strings.TrimPrefix(server.URL, "https:") + "/defaults.yaml"
+	expected := Context{"name": "remote", "replicas": 3.0}
+
+	for i := 0; i < 2; i++ {
+		ctx, err = httpsValues(o, url)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, ctx)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notMod), "revalidated by ETag")
+
+	sum := sha256.Sum256([]byte(document))
+
+	ctx, err = httpsValues(o, url+"#sha256="+hex.EncodeToString(sum[:]))
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, ctx)
+
+	_, err = httpsValues(o, url+"#sha256="+strings.Repeat("0", 64))
+
+	assert.True(t, errors.Is(err, ErrIntegrity))
+
+	ctx, err = httpsValues(o, strings.TrimPrefix(server.URL, "https:")+"/moved.yaml")
+
+	assert.Nil(t, err)
+	assert.Equal(t, expected, ctx, "redirected to https")
+
+	_, err = httpsValues(o, strings.TrimPrefix(server.URL, "https:")+"/insecure.yaml")
+
+	assert.True(t, errors.Is(err, ErrInsecureRedirect))
+
+	_, err = httpsValues(o, url+"#md5=00")
+
+	assert.True(t, errors.Is(err, ErrInvalidSource))
+
+	_, err = httpsValues(o, strings.TrimPrefix(server.URL, "https:")+"/missing.yaml")
+
+	assert.NotNil(t, err)
+
+	atomic.StoreInt32(&down, 1)
+
+	ctx, err = httpsValues(o, url)
+
+	assert.Nil(t, err, "offline fallback")
+	assert.Equal(t, expected, ctx)
+	assert.Contains(t, stderr.String(), "using cached values")
+
+	_, err = httpsValues(o, strings.TrimPrefix(server.URL, "https:")+"/other.yaml")
+
+	assert.NotNil(t, err, "not cached")
+}
+
+func TestRender_remote_once(t *testing.T) {
+	t.Parallel()
+
+	var hits int32
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("name: remote\n")) // nolint
+	}))
+
+	t.Cleanup(server.Close)
+
+	sink := NewMemorySink()
+
+	opts := &Options{ // nolint
+		FS:          fstest.MapFS{"templates/app.txt": {Data: []byte("{{ .Values.name }}\n")}},
+		Templates:   []string{"templates"},
+		Values:      []string{server.URL + "/defaults.yaml"},
+		Output:      "dist/{{.Env}}",
+		ValuesCache: t.TempDir(),
+		HTTPClient:  server.Client(),
+		Quiet:       true,
+		Sink:        sink,
+	}
+
+	_, err := Render(opts, "dev", "prod")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "remote\n", string(sink.Files()["dist/prod/app.txt"]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "fetched once per run")
+}
@@ -0,0 +1,99 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// Report describes the outcome of a generation run.
+type Report struct {
+	Files  []*FileReport
+	Pruned []string // files removed (or to be removed in dry-run mode) from the output directories
+
+	mu sync.Mutex
+}
+
+// FileReport describes a single output file of a generation run.
+type FileReport struct {
+	Env      string            `json:"env"`
+	Dims     map[string]string `json:"dims,omitempty"` // values of matrix dimensions
+	Source   string            `json:"source"`
+	Path     string            `json:"path"`
+	Format   string            `json:"format,omitempty"`
+	Schema   string            `json:"schema,omitempty"`
+	Dump     string            `json:"dump,omitempty"` // intermediate file (--dump)
+	SHA256   string            `json:"sha256"`
+	Size     int               `json:"size"`
+	Deps     []string          `json:"deps,omitempty"`     // input files the output depends on
+	Digest   string            `json:"digest,omitempty"`   // digest of the values and options the output is generated with
+	Volatile bool              `json:"volatile,omitempty"` // the output depends on environment variables or secrets
+	Err      error             `json:"-"`
+}
+
+func (f *FileReport) digest(data []byte) {
+	sum := sha256.Sum256(data)
+
+	f.SHA256 = hex.EncodeToString(sum[:])
+	f.Size = len(data)
+}
+
+func (r *Report) add(file *FileReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Files = append(r.Files, file)
+}
+
+// Failed returns reports of files failed to generate.
+func (r *Report) Failed() []*FileReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := []*FileReport{}
+
+	for _, f := range r.Files {
+		if f.Err != nil {
+			failed = append(failed, f)
+		}
+	}
+
+	return failed
+}
+
+// Err returns the first error of the run, or nil if all files were generated successfully.
+func (r *Report) Err() error {
+	failed := r.Failed()
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0].Err
+	default:
+		return fmt.Errorf("%w (and %d more errors)", failed[0].Err, len(failed)-1)
+	}
+}
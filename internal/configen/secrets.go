@@ -0,0 +1,470 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+var (
+	// ErrSecretNotFound returned if the secret provider has no secret with the given path or key.
+	ErrSecretNotFound = errors.New("secret not found")
+
+	// ErrNoSecretProvider returned if a template looks up a secret, but no secret provider is given.
+	ErrNoSecretProvider = errors.New("no secret provider (use --secrets)")
+
+	// ErrInvalidSecretPath returned for secret paths with empty, "." or ".." segments.
+	ErrInvalidSecretPath = errors.New("invalid secret path")
+)
+
+// SecretProvider looks up secrets. A secret is a set of named values, stored at a path.
+// Implementations must be safe for concurrent use.
+type SecretProvider interface {
+	Secret(path string) (map[string]interface{}, error)
+}
+
+// FileSecrets is a SecretProvider reading secrets from a local file or a directory of secret files.
+// In a file (yaml, json or toml) the path selects nested keys (db/prod: db.prod), in a directory
+// the path selects a file without extension (db/prod: db/prod.yaml). Files may be encrypted
+// by SOPS or age, like values files, and are decrypted in memory.
+type FileSecrets struct {
+	fsys       fs.FS
+	path       string
+	identities func() ([]age.Identity, error)
+
+	mu  sync.Mutex
+	doc Context // the content of the secrets file, read once
+}
+
+// NewFileSecrets returns a FileSecrets reading the named file or directory of fsys.
+// Encrypted files are decrypted using the age identities in SOPS_AGE_KEY_FILE or SOPS_AGE_KEY.
+func NewFileSecrets(fsys fs.FS, name string) *FileSecrets {
+	return &FileSecrets{fsys: fsys, path: name, identities: func() ([]age.Identity, error) {
+		return ageIdentities(new(Options))
+	}}
+}
+
+// Secret implements SecretProvider.
+func (s *FileSecrets) Secret(name string) (map[string]interface{}, error) {
+	info, err := fs.Stat(s.fsys, s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+
+	if info.IsDir() {
+		if value, err = s.readDir(name); err != nil {
+			return nil, err
+		}
+	} else {
+		if value, err = s.readFile(name); err != nil {
+			return nil, err
+		}
+	}
+
+	m, ok := asMap(value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	return m, nil
+}
+
+func (s *FileSecrets) readFile(name string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.doc == nil {
+		doc, err := s.read(s.path)
+		if err != nil {
+			return nil, err
+		}
+
+		s.doc = doc
+	}
+
+	var value interface{} = s.doc
+
+	for _, key := range strings.Split(strings.Trim(name, "/"), "/") {
+		m, ok := asMap(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+
+		if value, ok = m[key]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+	}
+
+	return value, nil
+}
+
+func (s *FileSecrets) readDir(name string) (interface{}, error) {
+	segments, err := splitSecretPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	clean := path.Join(segments...)
+
+	for _, format := range Formats() {
+		for _, suffix := range []string{"", ageSuffix} {
+			file := path.Join(s.path, clean+"."+format+suffix)
+
+			if _, err := fs.Stat(s.fsys, file); err == nil {
+				return s.read(file)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+func (s *FileSecrets) read(name string) (Context, error) {
+	b, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	format := valuesFormatOf(name)
+
+	if isAgeEncrypted(b) {
+		identities, err := s.identities()
+		if err != nil {
+			return nil, err
+		}
+
+		if b, err = decryptAge(b, identities); err != nil {
+			return nil, wrap(err, name)
+		}
+	}
+
+	ctx := Context{}
+	if err := ctx.unmarshal(b, format); err != nil {
+		return nil, wrap(err, name)
+	}
+
+	if isSOPS(ctx) {
+		identities, err := s.identities()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := decryptSOPS(ctx, b, format, identities); err != nil {
+			return nil, wrap(err, name)
+		}
+	}
+
+	return ctx, nil
+}
+
+// VaultSecrets is a SecretProvider reading secrets from a KV version 2 secrets engine
+// of a HashiCorp Vault compatible HTTP API.
+type VaultSecrets struct {
+	Addr      string        // address of the server, like https://vault.example.com:8200
+	Token     string        // sent in the X-Vault-Token header
+	Mount     string        // mount path of the secrets engine (default: secret)
+	Namespace string        // sent in the X-Vault-Namespace header, if not empty
+	Client    *http.Client  // used for the requests, if not nil
+	Timeout   time.Duration // timeout of requests without Client (default: 30s)
+}
+
+// NewVaultSecrets returns a VaultSecrets configured by the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+// environment variables, reading secrets from the given mount path.
+func NewVaultSecrets(mount string) *VaultSecrets {
+	return newVaultSecrets(new(Options), mount)
+}
+
+func newVaultSecrets(o *Options, mount string) *VaultSecrets {
+	return &VaultSecrets{
+		Addr:      o.getenv("VAULT_ADDR"),
+		Token:     o.getenv("VAULT_TOKEN"),
+		Namespace: o.getenv("VAULT_NAMESPACE"),
+		Mount:     mount,
+	}
+}
+
+// Secret implements SecretProvider.
+func (v *VaultSecrets) Secret(name string) (map[string]interface{}, error) {
+	mount := v.Mount
+	if len(mount) == 0 {
+		mount = "secret"
+	}
+
+	segments, err := splitSecretPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(v.Addr, "/") + "/v1/" + path.Join(mount, "data", strings.Join(segments, "/")))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	if len(v.Namespace) != 0 {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: v.Timeout}
+
+		if client.Timeout == 0 {
+			client.Timeout = remoteTimeout
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+		Errors []string `json:"errors"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", u.Path, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s: %s %s", u.Path, resp.Status, strings.Join(body.Errors, "; "))
+	case body.Data.Data == nil:
+		// deleted versions have no data
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	return body.Data.Data, nil
+}
+
+// splitSecretPath returns the segments of a secret path. Paths must not leave the secret store (or the mount
+// of the secrets engine), so empty, "." and ".." segments are rejected. Leading and trailing slashes are ignored.
+func splitSecretPath(name string) ([]string, error) {
+	segments := strings.Split(strings.Trim(name, "/"), "/")
+
+	for _, segment := range segments {
+		if len(segment) == 0 || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSecretPath, name)
+		}
+	}
+
+	return segments, nil
+}
+
+// newSecretProvider returns the secret provider of the options: Options.SecretProvider,
+// or the one given by Options.Secrets (file:path or vault:mount). It returns nil if none is given.
+func newSecretProvider(o *Options) (SecretProvider, error) {
+	if o.SecretProvider != nil {
+		return o.SecretProvider, nil
+	}
+
+	if len(o.Secrets) == 0 {
+		return nil, nil
+	}
+
+	idx := strings.IndexByte(o.Secrets, ':')
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: unknown secret provider %q", ErrInvalidSource, o.Secrets)
+	}
+
+	switch scheme, arg := o.Secrets[:idx], o.Secrets[idx+1:]; scheme {
+	case "file":
+		s := NewFileSecrets(o.fsys(), arg)
+
+		s.identities = func() ([]age.Identity, error) { return ageIdentities(o) }
+
+		return s, nil
+	case "vault":
+		return newVaultSecrets(o, arg), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown secret provider %q", ErrInvalidSource, o.Secrets)
+	}
+}
+
+// secrets caches the secrets of a provider during a run and writes the audit log of lookups.
+type secrets struct {
+	provider SecretProvider
+	audit    io.Writer
+
+	mu      sync.Mutex
+	entries map[string]*secretEntry
+}
+
+type secretEntry struct {
+	value map[string]interface{}
+	err   error
+	once  sync.Once
+}
+
+// secretAudit is a line of the audit log. Secret values are never logged.
+type secretAudit struct {
+	Time   time.Time         `json:"time"`
+	Env    string            `json:"env"`
+	Dims   map[string]string `json:"dims,omitempty"`
+	Source string            `json:"source,omitempty"`
+	Path   string            `json:"path"`
+	Key    string            `json:"key,omitempty"`
+	Cached bool              `json:"cached"`
+	Error  string            `json:"error,omitempty"`
+}
+
+func newSecrets(provider SecretProvider, audit io.Writer) *secrets {
+	return &secrets{provider: provider, audit: audit, entries: make(map[string]*secretEntry)}
+}
+
+// get returns the secret of the path, looked up only once.
+func (s *secrets) get(path string) (map[string]interface{}, bool, error) {
+	s.mu.Lock()
+
+	entry, cached := s.entries[path]
+	if !cached {
+		entry = new(secretEntry)
+		s.entries[path] = entry
+	}
+
+	s.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = s.provider.Secret(path)
+	})
+
+	return entry.value, cached, entry.err
+}
+
+// lookup returns the secret referenced by ref (path#key), or the whole secret if no key is given.
+func (s *secrets) lookup(g *generator, src, ref string) (interface{}, error) {
+	if s == nil {
+		return nil, ErrNoSecretProvider
+	}
+
+	path, key := ref, ""
+
+	if idx := strings.LastIndexByte(ref, '#'); idx >= 0 {
+		path, key = ref[:idx], ref[idx+1:]
+	}
+
+	secret, cached, err := s.get(path)
+
+	var value interface{}
+
+	if err == nil {
+		value = Context(secret)
+
+		if len(key) != 0 {
+			var ok bool
+
+			if value, ok = secret[key]; !ok {
+				err = fmt.Errorf("%w: %s", ErrSecretNotFound, ref)
+			}
+		}
+	}
+
+	s.log(&secretAudit{
+		Time: time.Now(), Env: g.env, Dims: g.dims, Source: src, Path: path, Key: key, Cached: cached, Error: errString(err),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	g.redactor.add(scalars(value)...)
+
+	return value, nil
+}
+
+func (s *secrets) log(entry *secretAudit) {
+	if s.audit == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	json.NewEncoder(s.audit).Encode(entry) // nolint
+}
+
+// openAudit opens the audit log file for appending.
+func openAudit(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// newSecretsFor returns the secret lookups of a run and the function closing the audit log.
+// It returns nil secrets if no secret provider is given.
+func newSecretsFor(o *Options) (*secrets, func(), error) {
+	provider, err := newSecretProvider(o)
+	if err != nil || provider == nil {
+		return nil, func() {}, err
+	}
+
+	if o.Audit != nil || len(o.SecretsAudit) == 0 {
+		return newSecrets(provider, o.Audit), func() {}, nil
+	}
+
+	file, err := openAudit(o.SecretsAudit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newSecrets(provider, file), func() { file.Close() }, nil // nolint
+}
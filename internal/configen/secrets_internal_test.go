@@ -0,0 +1,251 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// vaultStandIn returns a server speaking the read API of the KV version 2 secrets engine.
+func vaultStandIn(t *testing.T, token string, data map[string]map[string]interface{}, hits *int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`)) // nolint
+
+			return
+		}
+
+		secret, ok := data[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+		if r.Method != http.MethodGet || !strings.HasPrefix(r.URL.Path, "/v1/secret/data/") || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`)) // nolint
+
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{ // nolint
+			"data": map[string]interface{}{
+				"data":     secret,
+				"metadata": map[string]interface{}{"version": 1},
+			},
+		})
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestVaultSecrets_Secret(t *testing.T) {
+	t.Parallel()
+
+	var hits int32
+
+	server := vaultStandIn(t, "root", map[string]map[string]interface{}{
+		"db/prod": {"password": "s3cr3t", "user": "app"},
+	}, &hits)
+
+	v := &VaultSecrets{Addr: server.URL, Token: "root", Client: server.Client()}
+
+	secret, err := v.Secret("db/prod")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t", "user": "app"}, secret)
+
+	_, err = v.Secret("db/test")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	for _, name := range []string{"../../sys/config", "db/../../other/data/x", "db//prod", "./db"} {
+		_, err = v.Secret(name)
+
+		assert.True(t, errors.Is(err, ErrInvalidSecretPath), name)
+	}
+
+	atomic.StoreInt32(&hits, 0)
+
+	_, err = v.Secret("db/prod?version=1")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound), "query is escaped")
+	assert.Equal(t, int32(1), hits)
+
+	v.Token = "invalid"
+
+	_, err = v.Secret("db/prod")
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+}
+
+func TestVaultSecrets_Secret_timeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	t.Cleanup(server.Close)
+
+	v := &VaultSecrets{Addr: server.URL, Token: "root", Timeout: 50 * time.Millisecond}
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := v.Secret("db/prod")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Client.Timeout")
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to a stalling server did not time out")
+	}
+}
+
+func TestFileSecrets_Secret(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"secrets.yaml":         {Data: []byte("db:\n  prod:\n    password: s3cr3t\n")},
+		"keyring/db/prod.json": {Data: []byte(`{"password":"k3y"}`)},
+	}
+
+	secret, err := NewFileSecrets(fsys, "secrets.yaml").Secret("db/prod")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "s3cr3t"}, secret)
+
+	_, err = NewFileSecrets(fsys, "secrets.yaml").Secret("db/test")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	_, err = NewFileSecrets(fsys, "secrets.yaml").Secret("db/prod/password")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	secret, err = NewFileSecrets(fsys, "keyring").Secret("db/prod")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"password": "k3y"}, secret)
+
+	_, err = NewFileSecrets(fsys, "keyring").Secret("db/test")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	_, err = NewFileSecrets(fsys, "keyring").Secret("db/../../secrets")
+
+	assert.True(t, errors.Is(err, ErrInvalidSecretPath))
+}
+
+func TestRender_secret(t *testing.T) {
+	t.Parallel()
+
+	var hits int32
+
+	server := vaultStandIn(t, "root", map[string]map[string]interface{}{
+		"db/prod": {"password": "s3cr3t", "user": "app"},
+	}, &hits)
+
+	var audit bytes.Buffer
+
+	sink := NewMemorySink()
+
+	opts := &Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.txt": {Data: []byte(`{{ secret "db/prod#user" }}:{{ secret "db/prod#password" }}` + "\n")},
+			"templates/db.txt":  {Data: []byte(`{{ with secret "db/prod" }}{{ .user }}{{ end }}` + "\n")},
+		},
+		Templates: []string{"templates"},
+		Output:    "dist",
+		Secrets:   "vault:secret",
+		Environ:   map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "root"},
+		Audit:     &audit,
+		Dump:      true,
+		Quiet:     true,
+		Sink:      sink,
+	}
+
+	_, err := Render(opts, "prod")
+
+	assert.Nil(t, err)
+
+	files := sink.Files()
+
+	assert.Equal(t, "app:s3cr3t\n", string(files["dist/app.txt"]))
+	assert.Equal(t, "app:[REDACTED]\n", string(files["dist/app.txt~"]), "short values are not redacted")
+	assert.Equal(t, "app\n", string(files["dist/db.txt"]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits), "secrets are cached")
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+
+	assert.Equal(t, 3, len(lines))
+	assert.NotContains(t, audit.String(), "s3cr3t")
+
+	cached := 0
+
+	for _, line := range lines {
+		var entry secretAudit
+
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "prod", entry.Env)
+		assert.Equal(t, "db/prod", entry.Path)
+
+		if entry.Cached {
+			cached++
+		}
+	}
+
+	assert.Equal(t, 2, cached)
+
+	opts.FS = fstest.MapFS{"templates/app.txt": {Data: []byte(`{{ secret "db/prod#missing" }}`)}}
+
+	_, err = Render(opts, "prod")
+
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+
+	opts.Secrets = ""
+
+	_, err = Render(opts, "prod")
+
+	assert.True(t, errors.Is(err, ErrNoSecretProvider))
+}
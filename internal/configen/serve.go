@@ -0,0 +1,369 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	renderPath = "/render"
+
+	maxRenderRequest = 1 << 20
+
+	contentTypeJSON = "application/json"
+	contentTypeTar  = "application/x-tar"
+)
+
+// Serve starts an HTTP server providing the render API (POST /render) on the given port.
+func Serve(port int, opts *Options, envs ...string) error {
+	return ServeContext(context.Background(), port, opts, envs...)
+}
+
+// ServeContext is like Serve, but it stops serving when ctx is done.
+func ServeContext(ctx context.Context, port int, opts *Options, envs ...string) error {
+	copied := *opts
+
+	if err := bufferStdin(&copied); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle(renderPath, newRenderHandler(&copied, envs))
+
+	listener, err := net.Listen("tcp", addr(port))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(opts.stderr(), "Listening on http://%s\n", listener.Addr())
+
+	return serveHTTP(ctx, listener, mux)
+}
+
+// RenderRequest is the body of a render API request.
+type RenderRequest struct {
+	Env    string                 `json:"env,omitempty"`    // environment name (default: the first environment of the server)
+	Dims   map[string]string      `json:"dims,omitempty"`   // values of matrix dimensions, pinning values of the server's axes
+	Set    map[string]string      `json:"set,omitempty"`    // like --set
+	Values map[string]interface{} `json:"values,omitempty"` // values overriding values files and set
+	Format string                 `json:"format,omitempty"` // response format: json (default) or tar
+}
+
+// RenderResponse is the JSON response of a successful render API request.
+type RenderResponse struct {
+	Env   string          `json:"env"`
+	Files []*RenderedFile `json:"files"`
+}
+
+// RenderedFile is an output file in the render API response. Paths are slash separated
+// and relative to the output directory of the environment.
+type RenderedFile struct {
+	Path     string            `json:"path"`
+	Dims     map[string]string `json:"dims,omitempty"`
+	Source   string            `json:"source,omitempty"`
+	Format   string            `json:"format,omitempty"`
+	Schema   string            `json:"schema,omitempty"`
+	SHA256   string            `json:"sha256"`
+	Size     int               `json:"size"`
+	Content  string            `json:"content"`
+	Encoding string            `json:"encoding,omitempty"` // base64 for binary content
+}
+
+type renderHandler struct {
+	opts *Options
+	envs []string
+}
+
+func newRenderHandler(opts *Options, envs []string) http.Handler {
+	return &renderHandler{opts: opts, envs: envs}
+}
+
+func (h *renderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeErrors(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+
+		return
+	}
+
+	req := new(RenderRequest)
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRenderRequest))
+
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(req); err != nil && !errors.Is(err, io.EOF) {
+		writeErrors(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if len(req.Env) == 0 {
+		if len(h.envs) == 0 {
+			writeErrors(w, http.StatusBadRequest, errors.New("missing environment"))
+
+			return
+		}
+
+		req.Env = h.envs[0]
+	}
+
+	if !contains(h.envs, req.Env) {
+		writeErrors(w, http.StatusBadRequest, fmt.Errorf("environment not served: %s", req.Env))
+
+		return
+	}
+
+	if err := checkDims(h.opts.Axes, req.Dims); err != nil {
+		writeErrors(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	tarball := req.Format == "tar" || (len(req.Format) == 0 && accepts(r, contentTypeTar))
+
+	if !tarball && len(req.Format) != 0 && req.Format != "json" {
+		writeErrors(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrUnknownFormat, req.Format))
+
+		return
+	}
+
+	resp, files, err := h.render(req)
+	if err != nil {
+		writeErrors(w, http.StatusUnprocessableEntity, err, resp...)
+
+		return
+	}
+
+	if tarball {
+		writeTar(w, files)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	json.NewEncoder(w).Encode(&RenderResponse{Env: req.Env, Files: files}) // nolint
+}
+
+// render renders the requested environment into memory. On failure the reports of failed files are returned.
+func (h *renderHandler) render(req *RenderRequest) ([]*FileReport, []*RenderedFile, error) {
+	sink := NewMemorySink()
+
+	opts := *h.opts
+
+	opts.Sink = sink
+	opts.Dry = false
+	opts.Dump = false
+	opts.Quiet = true
+	opts.KeepGoing = true
+	opts.Package = ""
+	opts.Manifest = ""
+	opts.Prune = false
+	opts.Atomic = false
+	opts.Since = ""
+	opts.Previous = nil
+	opts.Define = make(map[string]string, len(h.opts.Define)+len(req.Set))
+	opts.Overrides = req.Values
+	opts.Axes = pinAxes(h.opts.Axes, req.Dims)
+
+	for k, v := range h.opts.Define {
+		opts.Define[k] = v
+	}
+
+	for k, v := range req.Set {
+		opts.Define[k] = v
+	}
+
+	report, err := Render(&opts, req.Env)
+	if err != nil {
+		return report.Failed(), nil, err
+	}
+
+	data := sink.Files()
+	files := make([]*RenderedFile, 0, len(report.Files))
+
+	for _, f := range report.Files {
+		dir, err := (target{env: f.Env, dims: f.Dims}).resolve(opts.Output)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rel, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file := &RenderedFile{
+			Path:   filepath.ToSlash(rel),
+			Dims:   f.Dims,
+			Source: filepath.ToSlash(f.Source),
+			Format: f.Format,
+			Schema: f.Schema,
+			SHA256: f.SHA256,
+			Size:   f.Size,
+		}
+
+		content := data[filepath.ToSlash(f.Path)]
+
+		if utf8.Valid(content) {
+			file.Content = string(content)
+		} else {
+			file.Content = base64.StdEncoding.EncodeToString(content)
+			file.Encoding = "base64"
+		}
+
+		files = append(files, file)
+	}
+
+	return nil, files, nil
+}
+
+func writeTar(w http.ResponseWriter, files []*RenderedFile) {
+	w.Header().Set("Content-Type", contentTypeTar)
+
+	tw := NewTarSink(w)
+
+	combos := make(map[string]bool)
+
+	for _, f := range files {
+		combos[dimsKey(f.Dims)] = true
+	}
+
+	for _, f := range files {
+		content := []byte(f.Content)
+
+		if f.Encoding == "base64" {
+			content, _ = base64.StdEncoding.DecodeString(f.Content)
+		}
+
+		name := f.Path
+
+		// files of different dimension combinations may have the same relative path
+		if len(combos) > 1 {
+			name = dimsKey(f.Dims) + "/" + name
+		}
+
+		if err := tw.WriteFile(name, content, filePerm); err != nil {
+			return
+		}
+	}
+
+	tw.Close() // nolint
+}
+
+// checkDims returns an error if dims has dimensions or values not given by axes.
+func checkDims(axes []string, dims map[string]string) error {
+	parsed, err := parseAxes(axes)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]string, len(parsed))
+
+	for _, a := range parsed {
+		values[a.name] = a.values
+	}
+
+	for name, value := range dims {
+		allowed, ok := values[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown dimension %s", ErrInvalidAxis, name)
+		}
+
+		if !contains(allowed, value) {
+			return fmt.Errorf("%w: unknown value of %s: %s", ErrInvalidAxis, name, value)
+		}
+	}
+
+	return nil
+}
+
+// pinAxes returns the axes with the values of dims pinned.
+func pinAxes(axes []string, dims map[string]string) []string {
+	pinned := make([]string, 0, len(axes))
+
+	for _, spec := range axes {
+		name := strings.SplitN(spec, "=", 2)[0]
+
+		if value, ok := dims[name]; ok {
+			spec = name + "=" + value
+		}
+
+		pinned = append(pinned, spec)
+	}
+
+	return pinned
+}
+
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeErrors writes err (or the errors of the failed files, if any) as a JSON response.
+func writeErrors(w http.ResponseWriter, code int, err error, failed ...*FileReport) {
+	errs := make([]*statusError, 0, len(failed)+1)
+
+	for _, f := range failed {
+		errs = append(errs, &statusError{Env: f.Env, Dims: f.Dims, Source: f.Source, Path: f.Path, Message: f.Err.Error()})
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, &statusError{Message: err.Error()})
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs}) // nolint
+}
+
+// accepts reports whether the Accept header of r lists the given media type.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(part); err == nil && t == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,153 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderHandler(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{ // nolint
+		FS: fstest.MapFS{
+			"templates/app.yaml": {Data: []byte("name: {{ .Values.name }}\nhost: {{ .Values.db.host }}:{{ .Values.db.port }}\n")},
+			"values.yaml":        {Data: []byte("name: app\ndb:\n  host: localhost\n  port: 5432\n")},
+		},
+		Templates: []string{"templates"},
+		Values:    []string{"values.yaml"},
+		Output:    "dist/{{.Env}}",
+		Define:    map[string]string{},
+		Loose:     true,
+	}
+
+	srv := httptest.NewServer(newRenderHandler(opts, []string{"dev", "prod"}))
+	defer srv.Close()
+
+	post := func(body string, accept string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+renderPath, strings.NewReader(body))
+
+		assert.Nil(t, err)
+
+		if len(accept) != 0 {
+			req.Header.Set("Accept", accept)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+
+		assert.Nil(t, err)
+
+		return res
+	}
+
+	res := post(`{"set":{"name":"other"},"values":{"db":{"host":"db.example.com"}}}`, "")
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, contentTypeJSON, res.Header.Get("Content-Type"))
+
+	resp := new(RenderResponse)
+
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(resp))
+	res.Body.Close()
+
+	assert.Equal(t, "dev", resp.Env)
+	assert.Len(t, resp.Files, 1)
+	assert.Equal(t, "app.yaml", resp.Files[0].Path)
+	assert.Equal(t, "name: other\nhost: db.example.com:5432\n", resp.Files[0].Content)
+
+	res = post(`{"env":"prod"}`, "application/x-tar")
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, contentTypeTar, res.Header.Get("Content-Type"))
+
+	b, err := ioutil.ReadAll(res.Body)
+
+	assert.Nil(t, err)
+	res.Body.Close()
+
+	tr := tar.NewReader(bytes.NewReader(b))
+
+	hdr, err := tr.Next()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "app.yaml", hdr.Name)
+
+	for _, body := range []string{
+		`{"env":"../../etc"}`,
+		`{"env":"test"}`,
+		`{"dims":{"tenant":"a"}}`,
+		`{"dims":{"region":"../.."}}`,
+	} {
+		res = post(body, "")
+		res.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+
+	res = post(`{"values":{"db":"broken"}}`, "")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+
+	var errs struct {
+		Errors []*statusError `json:"errors"`
+	}
+
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&errs))
+	res.Body.Close()
+
+	assert.Len(t, errs.Errors, 1)
+	assert.Equal(t, "templates/app.yaml", errs.Errors[0].Source)
+
+	res = post(`{"unknown":true}`, "")
+	res.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get(srv.URL + renderPath) // nolint
+
+	assert.Nil(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func Test_checkDims(t *testing.T) {
+	t.Parallel()
+
+	axes := []string{"region=eu,us"}
+
+	assert.Nil(t, checkDims(axes, map[string]string{"region": "eu"}))
+	assert.True(t, errors.Is(checkDims(axes, map[string]string{"region": "../.."}), ErrInvalidAxis))
+	assert.True(t, errors.Is(checkDims(axes, map[string]string{"tenant": "a"}), ErrInvalidAxis))
+}
@@ -0,0 +1,235 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSet returned for malformed --set paths and values.
+var ErrInvalidSet = errors.New("invalid set")
+
+// maxSetIndex limits list indexes of set paths, to avoid allocating huge lists by accident.
+const maxSetIndex = 65536
+
+// setElem is an element of a set path: a map key or a list index (if index is not negative).
+type setElem struct {
+	key   string
+	index int
+}
+
+// parseSetPath parses paths like a.b[0].c into elements. A backslash escapes the next character.
+func parseSetPath(path string) ([]setElem, error) {
+	elems := []setElem{}
+
+	var (
+		key     strings.Builder
+		pending bool // a key is expected (at start and after a dot)
+	)
+
+	pending = true
+
+	flush := func() error {
+		if key.Len() == 0 {
+			if pending {
+				return fmt.Errorf("%w: empty key in %q", ErrInvalidSet, path)
+			}
+
+			return nil
+		}
+
+		elems = append(elems, setElem{key: key.String(), index: -1})
+		key.Reset()
+
+		pending = false
+
+		return nil
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 == len(path) {
+				return nil, fmt.Errorf("%w: trailing backslash in %q", ErrInvalidSet, path)
+			}
+
+			i++
+			key.WriteByte(path[i])
+		case '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+
+			pending = true
+		case '[':
+			if len(elems) == 0 && key.Len() == 0 {
+				return nil, fmt.Errorf("%w: %q starts with an index", ErrInvalidSet, path)
+			}
+
+			if err := flush(); err != nil {
+				return nil, err
+			}
+
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: unclosed bracket in %q", ErrInvalidSet, path)
+			}
+
+			index, err := strconv.Atoi(path[i+1 : i+end])
+			if err != nil || index < 0 || index > maxSetIndex {
+				return nil, fmt.Errorf("%w: bad index %q in %q", ErrInvalidSet, path[i+1:i+end], path)
+			}
+
+			elems = append(elems, setElem{index: index})
+			i += end
+		default:
+			key.WriteByte(c)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return elems, nil
+}
+
+// setIn returns node with the value set at path. Maps and lists are created (or replaced) as needed.
+func setIn(node interface{}, path []setElem, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	elem, rest := path[0], path[1:]
+
+	if elem.index >= 0 {
+		list, _ := node.([]interface{})
+
+		for len(list) <= elem.index {
+			list = append(list, nil)
+		}
+
+		list[elem.index] = setIn(list[elem.index], rest, value)
+
+		return list
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		if ctx, isCtx := node.(Context); isCtx {
+			m = ctx
+		} else {
+			m = make(map[string]interface{})
+		}
+	}
+
+	m[elem.key] = setIn(m[elem.key], rest, value)
+
+	return m
+}
+
+// inferValue converts str to a YAML scalar (number, boolean or null), or keeps it as string.
+func inferValue(str string) interface{} {
+	if len(str) == 0 {
+		return str
+	}
+
+	var v interface{}
+
+	if err := yamlUnmarshal([]byte(str), &v); err != nil {
+		return str
+	}
+
+	switch v.(type) {
+	case nil, bool, float64:
+		return v
+	default:
+		return str
+	}
+}
+
+// newDefined returns the values given by the set options. The set files are recorded as values files.
+func (g *generator) newDefined(o *Options) (Context, error) {
+	defined := Context{}
+
+	kinds := []struct {
+		defines map[string]string
+		convert func(string) (interface{}, error)
+	}{
+		{o.Define, func(s string) (interface{}, error) { return inferValue(s), nil }},
+		{o.DefineString, func(s string) (interface{}, error) { return s, nil }},
+		{o.DefineJSON, func(s string) (interface{}, error) {
+			var v interface{}
+
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidSet, err)
+			}
+
+			return v, nil
+		}},
+		{o.DefineFile, func(s string) (interface{}, error) {
+			b, err := fs.ReadFile(o.fsys(), s)
+			if err != nil {
+				return nil, wrap(err, s)
+			}
+
+			g.values = append(g.values, s)
+
+			return string(b), nil
+		}},
+	}
+
+	// later kinds take precedence: --set, --set-string, --set-json, --set-file
+	for _, kind := range kinds {
+		names := make([]string, 0, len(kind.defines))
+
+		for name := range kind.defines {
+			names = append(names, name)
+		}
+
+		// shorter paths first, so a.b=x refines a={}
+		sort.Strings(names)
+
+		for _, name := range names {
+			path, err := parseSetPath(name)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := kind.convert(kind.defines[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			setIn(defined, path, value)
+		}
+	}
+
+	return defined, nil
+}
@@ -0,0 +1,135 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSetPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path    string
+		want    []setElem
+		wantErr bool
+	}{
+		{path: "a", want: []setElem{{key: "a", index: -1}}},
+		{path: "a.b[0].c", want: []setElem{{key: "a", index: -1}, {key: "b", index: -1}, {index: 0}, {key: "c", index: -1}}},
+		{path: "a[1][2]", want: []setElem{{key: "a", index: -1}, {index: 1}, {index: 2}}},
+		{path: `a\.b.c`, want: []setElem{{key: "a.b", index: -1}, {key: "c", index: -1}}},
+		{path: "", wantErr: true},
+		{path: "a..b", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "[0]", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a[-1]", wantErr: true},
+		{path: "a[0", wantErr: true},
+		{path: "a[100000]", wantErr: true},
+		{path: `a\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseSetPath(tt.path)
+
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidSet))
+
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_inferValue(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, float64(3), inferValue("3"))
+	assert.Equal(t, 1.5, inferValue("1.5"))
+	assert.Equal(t, true, inferValue("true"))
+	assert.Nil(t, inferValue("null"))
+	assert.Equal(t, "", inferValue(""))
+	assert.Equal(t, "x", inferValue("x"))
+	assert.Equal(t, "[1, 2]", inferValue("[1, 2]"))
+	assert.Equal(t, "a: b", inferValue("a: b"))
+}
+
+func TestGenerator_newDefined(t *testing.T) {
+	t.Parallel()
+
+	g := new(generator)
+	o := &Options{ // nolint
+		FS: fstest.MapFS{
+			"values.yaml": {Data: []byte("db:\n  host: localhost\n  port: 5432\nname: app\n")},
+			"cert.pem":    {Data: []byte("CERT")},
+		},
+		Values: []string{"values.yaml"},
+		Define: map[string]string{
+			"replicas":         "3",
+			"db.port":          "6543",
+			"servers[1].name":  "b",
+			"servers[0].name":  "a",
+			`labels.app\.kind`: "web",
+			"debug":            "false",
+		},
+		DefineString: map[string]string{"version": "1.10"},
+		DefineJSON:   map[string]string{"ports": "[80, 443]", "replicas": "5"},
+		DefineFile:   map[string]string{"tls.cert": "cert.pem"},
+	}
+
+	c, err := g.newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{
+		"name":     "app",
+		"replicas": float64(5),
+		"debug":    false,
+		"version":  "1.10",
+		"ports":    []interface{}{float64(80), float64(443)},
+		"db":       map[string]interface{}{"host": "localhost", "port": float64(6543)},
+		"servers": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+		},
+		"labels": map[string]interface{}{"app.kind": "web"},
+		"tls":    map[string]interface{}{"cert": "CERT"},
+	}, c["Values"])
+	assert.Contains(t, g.values, "cert.pem")
+
+	o.DefineJSON = map[string]string{"bad": "{"}
+
+	_, err = g.newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrInvalidSet))
+}
@@ -0,0 +1,147 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutputSink receives the generated output files.
+// Implementations must be safe for concurrent use.
+type OutputSink interface {
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// DirSink writes output files to the disk.
+type DirSink struct{}
+
+// WriteFile writes data to the named file, creating its directory if necessary.
+func (DirSink) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := mkdir(filepath.Dir(name)); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// MemorySink collects output files in memory.
+type MemorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemorySink returns a new, empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{files: make(map[string][]byte)}
+}
+
+// WriteFile stores data with the slash separated form of name.
+func (m *MemorySink) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	buff := make([]byte, len(data))
+	copy(buff, data)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[filepath.ToSlash(name)] = buff
+
+	return nil
+}
+
+// Files returns a copy of the collected files keyed by slash separated names.
+func (m *MemorySink) Files() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make(map[string][]byte, len(m.files))
+
+	for k, v := range m.files {
+		all[k] = v
+	}
+
+	return all
+}
+
+// Names returns the sorted names of the collected files.
+func (m *MemorySink) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.files))
+
+	for k := range m.files {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// TarSink writes output files into a tar stream.
+type TarSink struct {
+	mu sync.Mutex
+	w  *tar.Writer
+}
+
+// NewTarSink returns a new TarSink writing to w. The Close method must be called to finish the stream.
+func NewTarSink(w io.Writer) *TarSink {
+	return &TarSink{w: tar.NewWriter(w)}
+}
+
+// WriteFile writes a regular file entry to the tar stream.
+func (t *TarSink) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.ToSlash(name),
+		Mode:     int64(perm.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := t.w.Write(data)
+
+	return err
+}
+
+// Close finishes the tar stream.
+func (t *TarSink) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.w.Close()
+}
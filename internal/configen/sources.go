@@ -0,0 +1,286 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidSource returned for malformed values sources.
+var ErrInvalidSource = errors.New("invalid values source")
+
+// valuesSource reads values from a source other than a file. Sources are given as values files
+// in "scheme:argument" form, like env:CONFIGEN_VALUES.
+type valuesSource func(o *Options, arg string) (Context, error)
+
+var valuesSources = map[string]valuesSource{
+	"env":   envValues,
+	"exec":  execValues,
+	"https": httpsValues,
+}
+
+// stdinSpec is the values file name of the standard input.
+const stdinSpec = "-"
+
+// sourceOf returns the values source and its argument if spec is not a values file.
+func sourceOf(spec string) (valuesSource, string, bool) {
+	if spec == stdinSpec {
+		return stdinValues, "", true
+	}
+
+	idx := strings.IndexByte(spec, ':')
+	if idx < 0 {
+		return nil, "", false
+	}
+
+	source, ok := valuesSources[spec[:idx]]
+
+	return source, spec[idx+1:], ok
+}
+
+// isSource reports whether spec is a values source instead of a values file.
+func isSource(spec string) bool {
+	_, _, ok := sourceOf(spec)
+
+	return ok
+}
+
+// envSeparator separates the prefix and the nested keys in environment variable names.
+const envSeparator = "__"
+
+// envValues maps the environment variables named prefix__KEY__KEY... into nested keys (lower case, unless
+// the key has lower case letters, like prefix__db__maxConnections).
+// Numeric keys are list indexes, the type of values is inferred like with --set.
+func envValues(o *Options, prefix string) (Context, error) {
+	if len(prefix) == 0 {
+		return nil, fmt.Errorf("%w: missing environment variable prefix", ErrInvalidSource)
+	}
+
+	prefix += envSeparator
+
+	vars := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		if f := strings.SplitN(kv, "=", 2); len(f) == 2 {
+			vars[f[0]] = f[1]
+		}
+	}
+
+	for k, v := range o.Environ {
+		vars[k] = v
+	}
+
+	names := make([]string, 0, len(vars))
+
+	for name := range vars {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	ctx := Context{}
+
+	for _, name := range names {
+		keys := strings.Split(strings.TrimPrefix(name, prefix), envSeparator)
+		path := make([]setElem, 0, len(keys))
+
+		for i, key := range keys {
+			if len(key) == 0 {
+				return nil, fmt.Errorf("%w: empty key in %s", ErrInvalidSource, name)
+			}
+
+			if index, err := strconv.Atoi(key); err == nil && i != 0 {
+				if index < 0 || index > maxSetIndex {
+					return nil, fmt.Errorf("%w: bad index in %s", ErrInvalidSource, name)
+				}
+
+				path = append(path, setElem{index: index})
+
+				continue
+			}
+
+			// upper case keys (the convention of environment variables) are converted, others are kept
+			if key == strings.ToUpper(key) {
+				key = strings.ToLower(key)
+			}
+
+			path = append(path, setElem{key: key, index: -1})
+		}
+
+		setIn(ctx, path, inferValue(vars[name]))
+	}
+
+	return ctx, nil
+}
+
+// sourceCache holds the values read from sources during a run. Every target of the run gets the same
+// values: commands run, documents are fetched and the standard input is read only once.
+type sourceCache struct {
+	mu      sync.Mutex
+	entries map[string]*sourceEntry
+}
+
+type sourceEntry struct {
+	once sync.Once
+	ctx  Context
+	err  error
+}
+
+func newSourceCache() *sourceCache {
+	return &sourceCache{entries: make(map[string]*sourceEntry)}
+}
+
+// read returns a copy of the values of the source given by spec. Without cache the source is read every time.
+func (c *sourceCache) read(o *Options, spec string, source valuesSource, arg string) (Context, error) {
+	if c == nil {
+		return source(o, arg)
+	}
+
+	c.mu.Lock()
+
+	entry, ok := c.entries[spec]
+	if !ok {
+		entry = new(sourceEntry)
+		c.entries[spec] = entry
+	}
+
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.ctx, entry.err = source(o, arg)
+	})
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+
+	return cloneValue(entry.ctx).(Context), nil
+}
+
+// stdinBuffer is the standard input read up front, replayed by every run of watch and serve mode.
+type stdinBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+// BufferStdin reads the standard input up front if values are read from it (-f -), so later runs
+// (like the ones of Watch after an initial Render) get the same values. Buffering again is a no-op.
+func BufferStdin(o *Options) error {
+	return bufferStdin(o)
+}
+
+// bufferStdin reads the standard input up front if values are read from it (-f -),
+// so every run of a long running mode gets the same values.
+func bufferStdin(o *Options) error {
+	for _, spec := range o.Values {
+		if spec != stdinSpec {
+			continue
+		}
+
+		if _, ok := o.stdin().(*stdinBuffer); ok {
+			return nil
+		}
+
+		b, err := readStdin(o.stdin())
+		if err != nil {
+			return err
+		}
+
+		o.Stdin = &stdinBuffer{Reader: bytes.NewReader(b), data: b}
+
+		return nil
+	}
+
+	return nil
+}
+
+func readStdin(r io.Reader) ([]byte, error) {
+	if b, ok := r.(*stdinBuffer); ok {
+		return b.data, nil
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// stdinValues parses the standard input in the format given by Options.ValuesFormat.
+func stdinValues(o *Options, _ string) (Context, error) {
+	b, err := readStdin(o.stdin())
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(b, o.valuesFormat())
+}
+
+// execValues runs the command (split into words by white space, without shell) and parses its
+// standard output in the format given by Options.ValuesFormat. The command is killed after Options.ExecTimeout.
+func execValues(o *Options, command string) (Context, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: missing command", ErrInvalidSource)
+	}
+
+	format := o.valuesFormat()
+
+	if _, ok := parsers[format]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	var stdout bytes.Buffer
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.execTimeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // nolint:gosec
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = o.stderr()
+	cmd.Env = os.Environ()
+
+	for k, v := range o.Environ {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w after %s", ctx.Err(), o.execTimeout())
+		}
+
+		return nil, err
+	}
+
+	return Parse(stdout.Bytes(), format)
+}
@@ -0,0 +1,264 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_envValues(t *testing.T) {
+	t.Parallel()
+
+	o := &Options{ // nolint
+		Environ: map[string]string{
+			"APP__DB__HOST":           "db.example.com",
+			"APP__DB__PORT":           "5432",
+			"APP__DEBUG":              "true",
+			"APP__SERVERS__1__NAME":   "b",
+			"APP__SERVERS__0__NAME":   "a",
+			"APPLICATION__IGNORED":    "x",
+			"OTHER__DB__HOST":         "other",
+			"APP__MAX_CONNECTIONS":    "10",
+			"APP__VERSION":            "v1",
+			"APP__EMPTY":              "",
+			"APP__TAGS__0":            "x",
+			"APP__DB__maxConnections": "20",
+		},
+	}
+
+	ctx, err := envValues(o, "APP")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{
+		"db":              map[string]interface{}{"host": "db.example.com", "port": 5432.0, "maxConnections": 20.0},
+		"debug":           true,
+		"servers":         []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+		"max_connections": 10.0,
+		"version":         "v1",
+		"empty":           "",
+		"tags":            []interface{}{"x"},
+	}, ctx)
+
+	_, err = envValues(o, "")
+
+	assert.True(t, errors.Is(err, ErrInvalidSource))
+
+	o.Environ = map[string]string{"APP__DB____HOST": "x"}
+
+	_, err = envValues(o, "APP")
+
+	assert.True(t, errors.Is(err, ErrInvalidSource))
+}
+
+func TestGenerator_newContext_env(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"values.yaml":        {Data: []byte("$schema: values.schema.json\nreplicas: 1\nname: app\n")},
+		"values.schema.json": {Data: []byte(`{"type":"object","properties":{"replicas":{"type":"integer","maximum":5}}}`)},
+	}
+
+	o := &Options{ // nolint
+		FS:      fsys,
+		Values:  []string{"env:APP", "values.yaml"},
+		Environ: map[string]string{"APP__REPLICAS": "3"},
+	}
+
+	g := &generator{fsys: fsys}
+
+	c, err := g.newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, c["Values"].(Context)["replicas"])
+	assert.Equal(t, "app", c["Values"].(Context)["name"])
+	assert.Equal(t, []string{"values.yaml"}, g.values)
+
+	o.Environ = map[string]string{"APP__REPLICAS": "7"}
+
+	_, err = (&generator{fsys: fsys}).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrValidationError))
+
+	_, err = (&generator{fsys: fsys, loose: true}).newContext("", o)
+
+	assert.Nil(t, err)
+
+	// merged values are validated without sources too
+	o = &Options{FS: fsys, Values: []string{"values.yaml"}, Define: map[string]string{"replicas": "9"}} // nolint
+
+	_, err = (&generator{fsys: fsys}).newContext("", o)
+
+	assert.True(t, errors.Is(err, ErrValidationError))
+}
+
+func Test_stdinValues(t *testing.T) {
+	t.Parallel()
+
+	stdin := strings.NewReader(`{"name": "app", "replicas": 3}`)
+	o := &Options{Stdin: stdin, ValuesFormat: "json", Values: []string{"-"}} // nolint
+
+	assert.Nil(t, bufferStdin(o))
+
+	// replayed by every run of watch and serve mode
+	for i := 0; i < 2; i++ {
+		ctx, err := stdinValues(o, "")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Context{"name": "app", "replicas": 3.0}, ctx)
+	}
+
+	o = &Options{Stdin: strings.NewReader("name: app\n")} // nolint
+
+	ctx, err := stdinValues(o, "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "app"}, ctx)
+
+	o.ValuesFormat = "ini"
+
+	_, err = stdinValues(o, "")
+
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+}
+
+func Test_execValues(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("echo is not an executable")
+	}
+
+	ctx, err := execValues(&Options{ValuesFormat: "json"}, `echo {"name": "app"}`) // nolint
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "app"}, ctx)
+
+	_, err = execValues(&Options{}, "  ") // nolint
+
+	assert.True(t, errors.Is(err, ErrInvalidSource))
+
+	_, err = execValues(&Options{Stderr: ioutil.Discard}, "false") // nolint
+
+	assert.Error(t, err)
+
+	_, err = execValues(&Options{ValuesFormat: "ini"}, "true") // nolint
+
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+
+	_, err = execValues(&Options{ExecTimeout: 10 * time.Millisecond}, "sleep 10") // nolint
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_sourceCache(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+
+	source := func(o *Options, arg string) (Context, error) {
+		calls++
+
+		return Context{"name": arg, "db": map[string]interface{}{"port": 1.0}}, nil
+	}
+
+	cache := newSourceCache()
+
+	for i := 0; i < 2; i++ {
+		ctx, err := cache.read(new(Options), "test:app", source, "app")
+
+		assert.Nil(t, err)
+		assert.Equal(t, Context{"name": "app", "db": map[string]interface{}{"port": 1.0}}, ctx)
+
+		// callers get copies
+		ctx["db"].(map[string]interface{})["port"] = 2.0
+	}
+
+	assert.Equal(t, 1, calls)
+
+	_, err := (*sourceCache)(nil).read(new(Options), "test:app", source, "app")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestGenerator_newContext_stdin(t *testing.T) {
+	t.Parallel()
+
+	o := &Options{ // nolint
+		FS:     fstest.MapFS{"values.yaml": {Data: []byte("name: app\nreplicas: 1\n")}},
+		Values: []string{"-", "values.yaml"},
+		Stdin:  strings.NewReader("replicas: 2\n"),
+	}
+
+	sources := newSourceCache()
+
+	// standard input is read once per run
+	for _, env := range []string{"dev", "prod"} {
+		c, err := (&generator{sources: sources}).newContext(env, o)
+
+		assert.Nil(t, err)
+		assert.Equal(t, Context{"name": "app", "replicas": 2.0}, c["Values"])
+	}
+}
+
+func TestBufferStdin_watch(t *testing.T) {
+	t.Parallel()
+
+	sink := NewMemorySink()
+
+	opts := &Options{ // nolint
+		FS:        fstest.MapFS{"templates/app.txt": {Data: []byte("{{ .Values.x }}\n")}},
+		Templates: []string{"templates"},
+		Values:    []string{"-"},
+		Output:    "dist",
+		Stdin:     strings.NewReader("x: hello\n"),
+		Quiet:     true,
+		Sink:      sink,
+	}
+
+	// like configen -w -f -: the initial run, then the server of watch mode buffering stdin again
+	assert.Nil(t, BufferStdin(opts))
+
+	_, err := Render(opts, "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\n", string(sink.Files()["dist/app.txt"]))
+
+	copied := *opts
+
+	assert.Nil(t, bufferStdin(&copied))
+
+	ctx, err := stdinValues(&copied, "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"x": "hello"}, ctx)
+}
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const statusPath = "/_configen/status"
+
+// runStatus describes the last generation run of the watch server.
+type runStatus struct {
+	Time     time.Time      `json:"time"`
+	Duration float64        `json:"duration"` // seconds
+	Success  bool           `json:"success"`
+	Errors   []*statusError `json:"errors,omitempty"`
+
+	report *Report
+}
+
+// statusError describes a generation error, with the related file if known.
+type statusError struct {
+	Env     string            `json:"env,omitempty"`
+	Dims    map[string]string `json:"dims,omitempty"`
+	Source  string            `json:"source,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Message string            `json:"message"`
+}
+
+func newRunStatus(start time.Time, report *Report, err error) *runStatus {
+	st := &runStatus{
+		Time:     start,
+		Duration: time.Since(start).Seconds(),
+		Success:  err == nil,
+		report:   report,
+	}
+
+	if report != nil {
+		for _, f := range report.Failed() {
+			st.Errors = append(st.Errors, &statusError{Env: f.Env, Dims: f.Dims, Source: f.Source, Path: f.Path, Message: f.Err.Error()})
+		}
+	}
+
+	// errors not related to a single file (like invalid values files)
+	if err != nil && len(st.Errors) == 0 {
+		st.Errors = append(st.Errors, &statusError{Message: err.Error()})
+	}
+
+	return st
+}
+
+// statusHolder holds the status of the last run, safe for concurrent use.
+type statusHolder struct {
+	mu     sync.Mutex
+	status *runStatus
+}
+
+func (h *statusHolder) set(st *runStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status = st
+}
+
+func (h *statusHolder) get() *runStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.status
+}
+
+func (h *statusHolder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st := h.get()
+	if st == nil {
+		http.Error(w, "no generation yet", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	enc := json.NewEncoder(w)
+
+	enc.SetIndent("", "  ")
+	enc.Encode(st) // nolint
+}
+
+// overlay returns the HTML error overlay if the last run failed, or an empty string.
+func (h *statusHolder) overlay() string {
+	st := h.get()
+	if st == nil || st.Success {
+		return ""
+	}
+
+	var buff bytes.Buffer
+
+	if err := overlayTemplate.Execute(&buff, st); err != nil {
+		return ""
+	}
+
+	return buff.String()
+}
+
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<div id="configen-overlay" style="` +
+	`position:fixed;inset:0;z-index:2147483647;overflow:auto;padding:2em;` +
+	`background:rgba(0,0,0,.85);color:#fff;font:14px/1.5 monospace">` +
+	`<h2 style="color:#ff5555;margin-top:0">Generation failed</h2>` +
+	`{{ range .Errors }}<div style="margin-bottom:1em">` +
+	`{{ if .Source }}<div style="color:#aaa">{{ if .Env }}@{{ .Env }} {{ end }}{{ .Source }}</div>{{ end }}` +
+	`<pre style="white-space:pre-wrap;margin:0">{{ .Message }}</pre></div>{{ end }}` +
+	`<div style="color:#aaa">The page is reloaded after the next generation.</div></div>`))
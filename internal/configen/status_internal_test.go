@@ -0,0 +1,79 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHolder(t *testing.T) {
+	t.Parallel()
+
+	h := new(statusHolder)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, statusPath, nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "", h.overlay())
+
+	errBroken := errors.New("broken <tag>")
+
+	report := &Report{Files: []*FileReport{
+		{Env: "dev", Source: "templates/a.yaml", Path: "dist/a.yaml"},
+		{Env: "dev", Source: "templates/b.yaml", Err: errBroken},
+	}}
+
+	h.set(newRunStatus(time.Now(), report, errBroken))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, statusPath, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	st := new(runStatus)
+
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), st))
+	assert.False(t, st.Success)
+	assert.Equal(t, []*statusError{{Env: "dev", Source: "templates/b.yaml", Message: "broken <tag>"}}, st.Errors)
+
+	overlay := h.overlay()
+
+	assert.Contains(t, overlay, "templates/b.yaml")
+	assert.Contains(t, overlay, "broken &lt;tag&gt;")
+
+	h.set(newRunStatus(time.Now(), new(Report), errors.New("invalid values")))
+	assert.Equal(t, []*statusError{{Message: "invalid values"}}, h.get().Errors)
+
+	h.set(newRunStatus(time.Now(), &Report{Files: report.Files[:1]}, nil))
+	assert.True(t, h.get().Success)
+	assert.Equal(t, "", h.overlay())
+}
@@ -26,40 +26,43 @@ import (
 	"fmt"
 )
 
-func transform(data []byte, inFormat string) ([]byte, string, error) {
+// transform converts data to the format given by its $format property.
+// It returns the converted data, its format and the $schema property of the original data.
+func transform(data []byte, inFormat string) ([]byte, string, string, error) {
 	parser, ok := parsers[inFormat]
 	if !ok {
-		return data, inFormat, nil
+		return data, inFormat, "", nil
 	}
 
 	v := Context{}
 
 	if err := parser(data, &v); err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 
+	schema, hasSchema := v.get(propSchema)
+
 	outFormat, ok := v.get(propFormat)
 	if !ok {
-		return data, inFormat, nil
+		return data, inFormat, schema, nil
 	}
 
 	delete(v, propFormat)
 
-	schema, ok := v.get(propSchema)
-	if ok && outFormat != "json" {
+	if hasSchema && outFormat != "json" {
 		delete(v, propSchema)
 	}
 
 	b, err := v.marshal(outFormat)
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 
 	if fn, ok := headerFuncs[outFormat]; ok {
 		b = fn(b, schema)
 	}
 
-	return b, outFormat, nil
+	return b, outFormat, schema, nil
 }
 
 type headerFunc func([]byte, string) []byte
@@ -24,13 +24,19 @@ package configen
 
 import (
 	"bytes"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"sync"
 	"text/template"
 )
 
 func resolve(env string, str string) (string, error) {
+	return resolveVars(Context{"Env": env}, str)
+}
+
+// resolveVars executes the path template str with the given variables.
+func resolveVars(vars Context, str string) (string, error) {
 	t, err := template.New("str").Parse(str)
 	if err != nil {
 		return "", err
@@ -38,7 +44,7 @@ func resolve(env string, str string) (string, error) {
 
 	var buff bytes.Buffer
 
-	err = t.Execute(&buff, Context{"Env": env})
+	err = t.Execute(&buff, vars)
 	if err != nil {
 		return "", err
 	}
@@ -46,35 +52,30 @@ func resolve(env string, str string) (string, error) {
 	return buff.String(), nil
 }
 
-func resolveAll(env string, strs []string) ([]string, error) {
-	all := make([]string, len(strs))
-
-	for i, s := range strs {
-		r, err := resolve(env, s)
-		if err != nil {
-			return nil, err
-		}
+func mkdir(dir string) error {
+	return os.MkdirAll(dir, dirPerm)
+}
 
-		all[i] = r
-	}
+// osFS is an fs.FS backed by the operating system's file system.
+// Unlike os.DirFS it accepts any path (including absolute and parent relative ones),
+// so command line arguments can be used as is.
+type osFS struct{}
 
-	return all, nil
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
 }
 
-func mkdir(dir string) error {
-	if err := os.MkdirAll(dir, dirPerm); err != nil {
-		return err
-	}
-
-	index := filepath.Join(dir, "index.html")
+// syncWriter serializes writes of concurrently running jobs.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
 
-	if _, err := os.Stat(index); os.IsNotExist(err) {
-		if err := ioutil.WriteFile(index, []byte("<html></html>"), filePerm); err != nil {
-			return err
-		}
-	}
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return nil
+	return s.w.Write(p)
 }
 
 const (
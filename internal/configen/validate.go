@@ -26,6 +26,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
@@ -40,6 +41,23 @@ var ErrValidationError = errors.New("validation error")
 
 type schemaLoaders map[string]gojsonschema.JSONLoader
 
+// ValidateDocument validates document against the given JSON schema.
+// Schemas found in opts.Schemas directories (resolved for env) are used to resolve schema references.
+func ValidateDocument(opts *Options, env string, schema string, document interface{}) error {
+	g := new(generator)
+
+	g.fsys = opts.fsys()
+
+	loaders, err := g.newSchemaLoader(env, opts)
+	if err != nil {
+		return err
+	}
+
+	g.loaders = loaders
+
+	return g.validate(schema, document)
+}
+
 func (g *generator) validateRaw(b []byte, format string) (interface{}, error) {
 	fn, ok := parsers[format]
 	if !ok {
@@ -62,10 +80,33 @@ func (g *generator) validateRaw(b []byte, format string) (interface{}, error) {
 	return v, err
 }
 
+// validateValues validates the values of a values file against its $schema (if any).
+// The merge annotation is not part of the values, so it is not validated.
+func (g *generator) validateValues(ctx Context) error {
+	schema, ok := ctx.get(propSchema)
+	if !ok || g.loose {
+		return nil
+	}
+
+	doc := ctx
+
+	if _, ok := ctx[mergeKey]; ok {
+		doc = make(Context, len(ctx))
+
+		for k, v := range ctx {
+			if k != mergeKey {
+				doc[k] = v
+			}
+		}
+	}
+
+	return g.validate(schema, doc)
+}
+
 func (g *generator) validate(schema string, v interface{}) error {
 	loader := gojsonschema.NewGoLoader(v)
 
-	result, err := validate(schema, g.loaders, loader)
+	result, err := validate(g.fsys, schema, g.loaders, loader)
 	if err != nil {
 		return wrap(err, schema)
 	}
@@ -88,7 +129,12 @@ func (g *generator) validate(schema string, v interface{}) error {
 	return err
 }
 
-func validate(schema string, cache schemaLoaders, document gojsonschema.JSONLoader) (*gojsonschema.Result, error) {
+func validate(
+	fsys fs.FS,
+	schema string,
+	cache schemaLoaders,
+	document gojsonschema.JSONLoader,
+) (*gojsonschema.Result, error) {
 	sl := gojsonschema.NewSchemaLoader()
 
 	all := make([]gojsonschema.JSONLoader, 0, len(cache))
@@ -103,7 +149,7 @@ func validate(schema string, cache schemaLoaders, document gojsonschema.JSONLoad
 		return nil, err
 	}
 
-	s, err := sl.Compile(schemaLoader(schema, cache))
+	s, err := sl.Compile(schemaLoader(fsys, schema, cache))
 	if err != nil {
 		return nil, err
 	}
@@ -111,13 +157,20 @@ func validate(schema string, cache schemaLoaders, document gojsonschema.JSONLoad
 	return s.Validate(document)
 }
 
-func schemaLoader(schema string, loaders schemaLoaders) gojsonschema.JSONLoader {
+func schemaLoader(fsys fs.FS, schema string, loaders schemaLoaders) gojsonschema.JSONLoader {
 	if l, ok := loaders[schema]; ok {
 		return l
 	}
 
 	u, err := url.Parse(schema)
 	if err == nil && u.Scheme == "" {
+		// relative references of embedded schemas can not be resolved, but the schema itself can be loaded
+		if _, ok := fsys.(osFS); !ok {
+			if b, err := fs.ReadFile(fsys, path.Clean(u.Path)); err == nil {
+				return gojsonschema.NewBytesLoader(b)
+			}
+		}
+
 		u.Path = strings.TrimPrefix(path.Clean(u.Path), ".")
 		if !strings.HasPrefix(u.Path, "/") {
 			dir, _ := os.Getwd()
@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_newContext_dir(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"values.d/10-base.yaml":       {Data: []byte("name: base\nreplicas: 1\n")},
+		"values.d/20-prod.json":       {Data: []byte(`{"name": "prod"}`)},
+		"values.d/README.md":          {Data: []byte("# values")},
+		"values.d/.hidden.yaml":       {Data: []byte("name: hidden\n")},
+		"values.d/db/primary.yaml":    {Data: []byte("host: primary\n")},
+		"values.d/db/replica.yaml":    {Data: []byte("$merge: {lists: append}\nhosts: [a]\n")},
+		"values.d/db/replica/x.yaml":  {Data: []byte("hosts: [b]\n")},
+		"values.d/.git/config.yaml":   {Data: []byte("name: git\n")},
+		"values.d/broken/broken.yaml": {Data: []byte("name: [\n")},
+	}
+
+	o := &Options{FS: fsys, Values: []string{"values.d"}} // nolint
+
+	_, err := new(generator).newContext("", o)
+
+	assert.Error(t, err)
+
+	delete(fsys, "values.d/broken/broken.yaml")
+
+	g := new(generator)
+
+	c, err := g.newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{"name": "prod", "replicas": 1.0, "host": "primary", "hosts": []interface{}{"b", "a"}}, c["Values"])
+	assert.Contains(t, g.values, "values.d")
+	assert.Contains(t, g.values, "values.d/db/primary.yaml")
+
+	o.Values = []string{"values.d", "other.yaml"}
+	fsys["other.yaml"] = &fstest.MapFile{Data: []byte("name: other\nregion: eu\n")}
+
+	c, err = new(generator).newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "prod", c["Values"].(Context)["name"], "later files of the directory win, the directory wins over later values files")
+	assert.Equal(t, "eu", c["Values"].(Context)["region"])
+
+	delete(fsys, "other.yaml")
+
+	o.Values = []string{"values.d"}
+	o.ValuesDirKeys = true
+
+	c, err = new(generator).newContext("", o)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Context{
+		"10-base": map[string]interface{}{"name": "base", "replicas": 1.0},
+		"20-prod": map[string]interface{}{"name": "prod"},
+		"db": map[string]interface{}{
+			"primary": map[string]interface{}{"host": "primary"},
+			"replica": map[string]interface{}{
+				"hosts": []interface{}{"a"},
+				"x":     map[string]interface{}{"hosts": []interface{}{"b"}},
+			},
+		},
+	}, c["Values"])
+}
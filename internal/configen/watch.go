@@ -23,14 +23,19 @@
 package configen
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/jpillora/longestcommon"
@@ -39,12 +44,23 @@ import (
 // Watch start watching for changes of input files/directories and
 // call Generate when change happened.
 func Watch(port int, opts *Options, envs ...string) error {
+	return WatchContext(context.Background(), port, nil, opts, envs...)
+}
+
+// NotifyFunc is called with the result of each generation in watch mode.
+type NotifyFunc func(*Report, error)
+
+// WatchContext is like Watch, but it stops watching when ctx is done
+// and calls notify (if not nil) after each generation.
+func WatchContext(ctx context.Context, port int, notify NotifyFunc, opts *Options, envs ...string) error {
 	srv, err := newServer(port, opts, envs...)
 	if err != nil {
 		return err
 	}
 
-	return srv.run()
+	srv.notify = notify
+
+	return srv.run(ctx)
 }
 
 type server struct {
@@ -53,11 +69,25 @@ type server struct {
 	opts    *Options
 	envs    []string
 	port    int
+	stderr  io.Writer
+	notify  NotifyFunc
+	last    *Report // report of the previous generation, used for incremental generation
+	inputs  []string
+	outputs []string
+	events  *broadcaster
+	status  *statusHolder
+	after   func(time.Duration) <-chan time.Time // debounce timer (default: time.After)
 }
 
 func newServer(port int, opts *Options, envs ...string) (*server, error) {
 	srv := new(server)
 
+	copied := *opts
+
+	if err := bufferStdin(&copied); err != nil {
+		return nil, err
+	}
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -65,9 +95,12 @@ func newServer(port int, opts *Options, envs ...string) (*server, error) {
 
 	srv.watcher = watcher
 
-	srv.opts = opts
+	srv.opts = &copied
 	srv.envs = envs
 	srv.port = port
+	srv.stderr = opts.stderr()
+	srv.events = newBroadcaster()
+	srv.status = new(statusHolder)
 
 	if err := srv.init(); err != nil {
 		return nil, err
@@ -76,14 +109,10 @@ func newServer(port int, opts *Options, envs ...string) (*server, error) {
 	return srv, nil
 }
 
-func (s *server) run() error {
+func (s *server) run(ctx context.Context) error {
 	defer s.watcher.Close()
 
-	done := make(chan bool)
-
-	go s.watch()
-
-	http.Handle("/", http.FileServer(http.Dir(s.dir)))
+	mux := s.handler()
 
 	listener, err := net.Listen("tcp", addr(s.port))
 	if err != nil {
@@ -92,42 +121,140 @@ func (s *server) run() error {
 
 	port := listener.Addr().(*net.TCPAddr).Port
 
-	os.Setenv("PORT", strconv.Itoa(port))
+	s.setenv("PORT", strconv.Itoa(port))
 
-	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", addr(port))
+	fmt.Fprintf(s.stderr, "Listening on http://%s\n", addr(port))
 	s.onModify()
 
-	if err := http.Serve(listener, nil); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-	}
+	go s.watch()
+
+	return serveHTTP(ctx, listener, mux)
+}
+
+// handler returns the handler of the watch mode HTTP server. Directories without index.html are listed
+// (before pages are served with the reload script), so placeholders of earlier versions do not hide listings.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle(eventsPath, s.events)
+	mux.Handle(statusPath, s.status)
+	mux.Handle(renderPath, newRenderHandler(s.opts, s.envs))
+	mux.Handle("/", s.listing(injectReload(http.Dir(s.dir), http.FileServer(http.Dir(s.dir)), s.status.overlay)))
+
+	return mux
+}
+
+// serveHTTP serves HTTP requests on listener using handler, until ctx is done.
+func serveHTTP(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	httpd := &http.Server{Handler: handler}
+	done := make(chan struct{})
+
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			httpd.Close()
+		case <-done:
+		}
+	}()
 
-	<-done
+	if err := httpd.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
 
 	return nil
 }
 
+// setenv makes an environment variable visible for templates without modifying the process environment.
+func (s *server) setenv(key, value string) {
+	environ := make(map[string]string, len(s.opts.Environ)+1)
+
+	for k, v := range s.opts.Environ {
+		environ[k] = v
+	}
+
+	environ[key] = value
+
+	s.opts.Environ = environ
+}
+
 func (s *server) onCreate(path string) {
 	if _, err := os.Stat(path); err == nil {
 		if err := s.watcher.Add(path); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(s.stderr, err)
 		}
 	}
 }
 
-func (s *server) onModify() {
-	fmt.Fprint(os.Stderr, "Change detected, generating ... ")
+// onModify generates the outputs affected by the changed files (all outputs if none given).
+func (s *server) onModify(changed ...string) {
+	fmt.Fprint(s.stderr, "Change detected, generating ... ")
+
+	opts := *s.opts
+
+	if s.last != nil && len(changed) != 0 {
+		opts.Previous = s.last
+		opts.Changed = changed
+	}
+
+	start := time.Now()
 
-	if err := Generate(s.opts, s.envs...); err != nil {
-		fmt.Fprintln(os.Stderr, "failed")
-		fmt.Fprintln(os.Stderr, err)
+	report, err := Render(&opts, s.envs...)
+
+	s.last = report
+	s.status.set(newRunStatus(start, report, err))
+
+	if s.notify != nil {
+		s.notify(report, err)
+	}
+
+	if err != nil {
+		fmt.Fprintln(s.stderr, "failed")
+		fmt.Fprintln(s.stderr, err)
+		s.events.publish(eventFailed, err.Error())
 
 		return
 	}
 
-	fmt.Fprintln(os.Stderr, "done")
+	fmt.Fprintln(s.stderr, "done")
+	s.events.publish(eventRegenerated, "")
 }
 
+// watch collects file system events and calls onModify with the changed files once no event
+// arrived for the debounce period. Events arriving during a generation are coalesced into
+// the next one, so only one generation runs at a time.
 func (s *server) watch() {
+	s.watchEvents(s.onModify)
+}
+
+// watchEvents is the event loop of watch, calling modify with the changed files.
+func (s *server) watchEvents(modify func(changed ...string)) {
+	var (
+		pending = make(map[string]bool)
+		fire    <-chan time.Time // the timer of the last event, nil if there is none
+		done    = make(chan struct{}, 1)
+		running bool
+	)
+
+	start := func() {
+		changed := make([]string, 0, len(pending))
+
+		for name := range pending {
+			changed = append(changed, name)
+		}
+
+		sort.Strings(changed)
+
+		pending = make(map[string]bool)
+		running = true
+
+		go func() {
+			modify(changed...)
+			done <- struct{}{}
+		}()
+	}
+
 	for {
 		select {
 		case event, ok := <-s.watcher.Events:
@@ -139,31 +266,98 @@ func (s *server) watch() {
 				s.onCreate(event.Name)
 			}
 
-			s.onModify()
+			if s.ignored(event.Name) {
+				continue
+			}
+
+			pending[event.Name] = true
+			fire = s.timer(s.debounce())
+
+		case <-fire:
+			fire = nil
+
+			if !running && len(pending) != 0 {
+				start()
+			}
+
+		case <-done:
+			running = false
+
+			if len(pending) != 0 {
+				start()
+			}
 
 		case err, ok := <-s.watcher.Errors:
 			if !ok {
 				return
 			}
 
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(s.stderr, err)
 		}
 	}
 }
 
+func (s *server) timer(d time.Duration) <-chan time.Time {
+	if s.after != nil {
+		return s.after(d)
+	}
+
+	return time.After(d)
+}
+
+func (s *server) debounce() time.Duration {
+	if s.opts.Debounce > 0 {
+		return s.opts.Debounce
+	}
+
+	return defaultDebounce
+}
+
+// ignored reports whether the event of the named file should be ignored: files written
+// by the generation (under output directories, but not under input ones) and staging files.
+func (s *server) ignored(name string) bool {
+	if strings.Contains(filepath.Base(name), stageSuffix) {
+		return true
+	}
+
+	abs := absPath(name)
+
+	for _, in := range s.inputs {
+		if isInside(abs, absPath(in)) {
+			return false
+		}
+	}
+
+	for _, out := range s.outputs {
+		if isInside(abs, absPath(out)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *server) init() error {
-	outs := make([]string, 0, len(s.envs)+1)
+	all, err := targets(s.opts, s.envs)
+	if err != nil {
+		return err
+	}
+
+	outs := make([]string, 0, len(all)+1)
 	set := make(map[string]bool)
 
 	outs = append(outs, s.opts.Output)
 
-	for _, env := range s.envs {
-		out, err := resolve(env, s.opts.Output)
+	for _, t := range all {
+		env := t.env
+
+		out, err := t.resolve(s.opts.Output)
 		if err != nil {
 			return err
 		}
 
 		outs = append(outs, out)
+		s.outputs = append(s.outputs, out)
 
 		if len(s.opts.Package) != 0 {
 			if err := resolveToMap(env, []string{s.opts.Package}, set); err != nil {
@@ -178,14 +372,34 @@ func (s *server) init() error {
 			s.opts.Schemas...),
 			s.opts.Values...)
 
-		if err := resolveToMap(env, paths, set); err != nil {
+		for _, file := range s.opts.DefineFile {
+			paths = append(paths, file)
+		}
+
+		chain, err := envChain(env, s.opts.Inherit)
+		if err != nil {
+			return err
+		}
+
+		inputs, err := layered(s.opts.fsys(), chain, t.dims, paths)
+		if err != nil {
 			return err
 		}
+
+		for _, layers := range inputs {
+			for _, path := range layers {
+				if !isSource(path) {
+					set[path] = true
+				}
+			}
+		}
 	}
 
 	s.dir = strings.TrimSuffix(longestcommon.Prefix(outs), string([]byte{filepath.Separator}))
 
 	for k := range set {
+		s.inputs = append(s.inputs, k)
+
 		if err := watchDeep(s.watcher, k); err != nil {
 			return err
 		}
@@ -230,6 +444,8 @@ func watchDeep(watcher *fsnotify.Watcher, path string) error {
 	})
 }
 
+const defaultDebounce = 100 * time.Millisecond
+
 func addr(port int) string {
 	return "127.0.0.1:" + strconv.Itoa(port)
 }
@@ -0,0 +1,105 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_watchEvents(t *testing.T) {
+	t.Parallel()
+
+	var (
+		events  = make(chan fsnotify.Event)
+		timers  = make(chan chan time.Time, 10)
+		runs    = make(chan []string, 10)
+		release = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+
+	s := &server{
+		watcher: &fsnotify.Watcher{Events: events, Errors: make(chan error)},
+		opts:    new(Options),
+		stderr:  ioutil.Discard,
+		outputs: []string{"dist"},
+		after: func(time.Duration) <-chan time.Time {
+			timer := make(chan time.Time)
+			timers <- timer
+
+			return timer
+		},
+	}
+
+	go func() {
+		s.watchEvents(func(changed ...string) {
+			runs <- changed
+			<-release
+		})
+		close(stopped)
+	}()
+
+	write := func(name string) chan time.Time {
+		events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+
+		return <-timers
+	}
+
+	stale := write("a.txt")
+	last := write("b.txt")
+
+	select {
+	case stale <- time.Now():
+		assert.Fail(t, "timer of an earlier event is still watched")
+	default:
+	}
+
+	// output files are ignored, no timer is started
+	events <- fsnotify.Event{Name: filepath.Join("dist", "a.txt"), Op: fsnotify.Write}
+
+	assert.Len(t, timers, 0)
+
+	last <- time.Now()
+
+	assert.Equal(t, []string{"a.txt", "b.txt"}, <-runs)
+
+	// events arriving during a generation are coalesced into the next one
+	write("c.txt") <- time.Now()
+	write("d.txt") <- time.Now()
+
+	assert.Len(t, runs, 0)
+
+	release <- struct{}{}
+
+	assert.Equal(t, []string{"c.txt", "d.txt"}, <-runs)
+
+	release <- struct{}{}
+
+	close(events)
+	<-stopped
+}
@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/internal/configen"
+)
+
+func TestWatchContext(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	output := filepath.Join(dir, "dist")
+
+	assert.Nil(t, os.MkdirAll(templates, 0o755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(templates, "a.txt"), []byte("a"), 0o600))
+
+	opts := &configen.Options{ // nolint
+		Templates: []string{templates},
+		Output:    output,
+		Define:    map[string]string{},
+		Quiet:     true,
+		Stderr:    ioutil.Discard,
+		Debounce:  50 * time.Millisecond,
+	}
+
+	runs := make(chan *configen.Report, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go configen.WatchContext(ctx, 0, func(r *configen.Report, err error) { runs <- r }, opts, "dev") // nolint
+
+	waitRun(t, runs)
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(templates, "a.txt"), []byte{byte('a' + i)}, 0o600))
+	}
+
+	// writes may be coalesced into one or more generations (see TestServer_watchEvents), the last one wins
+	for {
+		report := waitRun(t, runs)
+
+		assert.Len(t, report.Files, 1)
+
+		if b, _ := ioutil.ReadFile(filepath.Join(output, "a.txt")); string(b) == "e" {
+			break
+		}
+	}
+}
+
+func waitRun(t *testing.T, runs chan *configen.Report) *configen.Report {
+	t.Helper()
+
+	select {
+	case r := <-runs:
+		return r
+	case <-time.After(5 * time.Second):
+		assert.FailNow(t, "generation timed out")
+	}
+
+	return nil
+}
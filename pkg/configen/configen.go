@@ -0,0 +1,241 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package configen is the Go API of the configen template based configuration generator.
+//
+// The Generator type provides the same functionality as the configen command line tool,
+// but it returns structured results instead of writing to the console.
+//
+//	g := configen.New(
+//		configen.WithTemplates("templates"),
+//		configen.WithValues("values.yaml"),
+//		configen.WithOutput("dist/{{.Env}}"),
+//		configen.WithEnv("staging", "production"),
+//	)
+//
+//	result, err := g.Render()
+package configen
+
+import (
+	"io"
+	"io/fs"
+
+	"github.com/szkiba/configen/internal/configen"
+)
+
+// Context defines generic JSON/YAML/TOML values type.
+type Context = configen.Context
+
+// Result describes the outcome of a generation run.
+type Result = configen.Report
+
+// File describes a single output file of a generation run.
+type File = configen.FileReport
+
+// Drift describes a difference between the output directory and a fresh render.
+type Drift = configen.Drift
+
+// DriftKind classifies the difference between an output file and its fresh render.
+type DriftKind = configen.DriftKind
+
+// Kinds of drifts.
+const (
+	DriftChanged = configen.DriftChanged
+	DriftMissing = configen.DriftMissing
+	DriftExtra   = configen.DriftExtra
+)
+
+// FileDiff describes the difference of an output file between two environments.
+type FileDiff = configen.FileDiff
+
+// Change describes the difference of a single value of a data file between two environments.
+type Change = configen.Change
+
+// DiffKind classifies the difference of a file or a value between two environments.
+type DiffKind = configen.DiffKind
+
+// Kinds of differences between environments.
+const (
+	DiffAdded   = configen.DiffAdded
+	DiffRemoved = configen.DiffRemoved
+	DiffChanged = configen.DiffChanged
+)
+
+// Merge strategies of values files.
+const (
+	MergeKeepFirst = configen.MergeKeepFirst
+	MergeOverride  = configen.MergeOverride
+)
+
+// List merge modes of values files.
+const (
+	ListsReplace     = configen.ListsReplace
+	ListsAppend      = configen.ListsAppend
+	ListsMergePrefix = configen.ListsMergePrefix
+)
+
+// Null handling modes of values files.
+const (
+	NullsIgnore = configen.NullsIgnore
+	NullsDelete = configen.NullsDelete
+)
+
+// Manifest describes the files emitted by a generation run.
+type Manifest = configen.Manifest
+
+// ManifestEntry describes a single emitted file of a Manifest.
+type ManifestEntry = configen.ManifestEntry
+
+// ReadManifest reads a manifest written by a previous generation run.
+func ReadManifest(path string) (*Manifest, error) {
+	return configen.ReadManifest(path)
+}
+
+// Project holds the settings of a project file (configen.yaml, configen.toml or configen.json).
+type Project = configen.Project
+
+// ProjectEnv describes an environment of a Project.
+type ProjectEnv = configen.ProjectEnv
+
+// ProjectDefaults holds default option values of a Project.
+type ProjectDefaults = configen.ProjectDefaults
+
+// FindProject returns the name of the project file in dir, or an empty string if there is none.
+func FindProject(dir string) string {
+	return configen.FindProject(dir)
+}
+
+// LoadProject reads and validates a project file. Relative paths are resolved against its directory.
+func LoadProject(path string) (*Project, error) {
+	return configen.LoadProject(path)
+}
+
+// RenderRequest is the body of a render API request (see Generator.Serve).
+type RenderRequest = configen.RenderRequest
+
+// RenderResponse is the JSON response of a render API request.
+type RenderResponse = configen.RenderResponse
+
+// RenderedFile is an output file in a RenderResponse.
+type RenderedFile = configen.RenderedFile
+
+// OutputSink receives the generated output files.
+type OutputSink = configen.OutputSink
+
+// DirSink writes output files to the disk.
+type DirSink = configen.DirSink
+
+// MemorySink collects output files in memory.
+type MemorySink = configen.MemorySink
+
+// TarSink writes output files into a tar stream.
+type TarSink = configen.TarSink
+
+// NewMemorySink returns a new, empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return configen.NewMemorySink()
+}
+
+// NewTarSink returns a new TarSink writing to w. The Close method must be called to finish the stream.
+func NewTarSink(w io.Writer) *TarSink {
+	return configen.NewTarSink(w)
+}
+
+// SecretProvider looks up secrets of the secret template function.
+type SecretProvider = configen.SecretProvider
+
+// FileSecrets is a SecretProvider reading secrets from a local file or a directory of secret files.
+type FileSecrets = configen.FileSecrets
+
+// VaultSecrets is a SecretProvider reading secrets from a Vault compatible KV version 2 HTTP API.
+type VaultSecrets = configen.VaultSecrets
+
+// NewFileSecrets returns a FileSecrets reading the named file or directory of fsys.
+func NewFileSecrets(fsys fs.FS, name string) *FileSecrets {
+	return configen.NewFileSecrets(fsys, name)
+}
+
+// NewVaultSecrets returns a VaultSecrets configured by the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE
+// environment variables, reading secrets from the given mount path.
+func NewVaultSecrets(mount string) *VaultSecrets {
+	return configen.NewVaultSecrets(mount)
+}
+
+var (
+	// ErrUnknownFormat returned when file format unsupported or unrecognizable from file extension.
+	ErrUnknownFormat = configen.ErrUnknownFormat
+
+	// ErrValidationError returned if JSON schema validation failed.
+	ErrValidationError = configen.ErrValidationError
+
+	// ErrUnsafeAtomic returned if output directories can not be replaced as a whole.
+	ErrUnsafeAtomic = configen.ErrUnsafeAtomic
+
+	// ErrNoManifest returned if incremental generation is requested without a manifest.
+	ErrNoManifest = configen.ErrNoManifest
+
+	// ErrInheritanceCycle returned if environment parents form a cycle.
+	ErrInheritanceCycle = configen.ErrInheritanceCycle
+
+	// ErrInvalidAxis returned for malformed matrix dimensions and exclusions.
+	ErrInvalidAxis = configen.ErrInvalidAxis
+
+	// ErrInvalidSet returned for malformed set paths and values.
+	ErrInvalidSet = configen.ErrInvalidSet
+
+	// ErrInvalidSource returned for malformed values sources.
+	ErrInvalidSource = configen.ErrInvalidSource
+
+	// ErrNoDecryptionKey returned if an encrypted values file is found, but no age identity is given.
+	ErrNoDecryptionKey = configen.ErrNoDecryptionKey
+
+	// ErrDecryption returned if an encrypted values file can not be decrypted.
+	ErrDecryption = configen.ErrDecryption
+
+	// ErrIntegrity returned if the content of a remote values file does not match its pinned checksum.
+	ErrIntegrity = configen.ErrIntegrity
+
+	// ErrInsecureRedirect returned if fetching a remote values file is redirected to a non-https URL.
+	ErrInsecureRedirect = configen.ErrInsecureRedirect
+
+	// ErrSecretNotFound returned if the secret provider has no secret with the given path or key.
+	ErrSecretNotFound = configen.ErrSecretNotFound
+
+	// ErrNoSecretProvider returned if a template looks up a secret, but no secret provider is given.
+	ErrNoSecretProvider = configen.ErrNoSecretProvider
+
+	// ErrInvalidSecretPath returned for secret paths with empty, "." or ".." segments.
+	ErrInvalidSecretPath = configen.ErrInvalidSecretPath
+
+	// ErrInvalidMerge returned for unknown merge strategies and malformed merge annotations.
+	ErrInvalidMerge = configen.ErrInvalidMerge
+)
+
+// Parse parses data in the given format (see Formats) into a new Context.
+func Parse(data []byte, format string) (Context, error) {
+	return configen.Parse(data, format)
+}
+
+// Formats returns the sorted list of supported data formats.
+func Formats() []string {
+	return configen.Formats()
+}
@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/szkiba/configen/internal/configen"
+)
+
+// Generator generates configuration files from templates.
+type Generator struct {
+	opts    configen.Options
+	envs    []string
+	project *configen.Project
+}
+
+// New returns a new Generator configured by options.
+func New(options ...Option) *Generator {
+	g := new(Generator)
+
+	g.opts.Define = make(map[string]string)
+	g.opts.DefineString = make(map[string]string)
+	g.opts.DefineJSON = make(map[string]string)
+	g.opts.DefineFile = make(map[string]string)
+	g.opts.Stdout = ioutil.Discard
+	g.opts.Stderr = ioutil.Discard
+
+	for _, opt := range options {
+		opt(g)
+	}
+
+	g.applyDefaults()
+
+	return g
+}
+
+// Render generates output files for all environments.
+func (g *Generator) Render() (*Result, error) {
+	opts := g.opts
+
+	return configen.Render(&opts, g.envs...)
+}
+
+// Validate renders and validates all templates without writing output files.
+// It does not stop at the first error, the returned Result contains every failure.
+func (g *Generator) Validate() (*Result, error) {
+	opts := g.opts
+
+	opts.Dry = true
+	opts.KeepGoing = true
+
+	return configen.Render(&opts, g.envs...)
+}
+
+// Check renders all environments into memory and compares the result with the files in the output directories.
+// The returned drifts (changed, missing and extra files with unified diffs) are sorted by path.
+func (g *Generator) Check() ([]*Drift, error) {
+	opts := g.opts
+
+	return configen.Check(&opts, g.envs...)
+}
+
+// Diff renders the a and b environments into memory and compares their output files.
+// Files in data formats are compared key by key, other files line by line.
+func (g *Generator) Diff(a, b string) ([]*FileDiff, error) {
+	opts := g.opts
+
+	return configen.Diff(&opts, a, b)
+}
+
+// ValidateDocument validates document against the given JSON schema.
+// Schema directories of the Generator are used to resolve schema references.
+func (g *Generator) ValidateDocument(schema string, document interface{}) error {
+	opts := g.opts
+
+	return configen.ValidateDocument(&opts, g.envs[0], schema, document)
+}
+
+// Watch serves the output directory on the given HTTP port (0 means random port)
+// and regenerates output files on changes of input files, until ctx is done.
+// The fn function (if not nil) is called with the result of each generation.
+func (g *Generator) Watch(ctx context.Context, port int, fn func(*Result, error)) error {
+	opts := g.opts
+
+	return configen.WatchContext(ctx, port, fn, &opts, g.envs...)
+}
+
+// Serve starts an HTTP server on the given port (0 means random port) providing the render API,
+// until ctx is done. POST /render with a RenderRequest body renders an environment on demand,
+// without writing output files.
+func (g *Generator) Serve(ctx context.Context, port int) error {
+	opts := g.opts
+
+	return configen.ServeContext(ctx, port, &opts, g.envs...)
+}
@@ -0,0 +1,154 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/configen/pkg/configen"
+)
+
+func newGenerator(t *testing.T, opts ...configen.Option) (*configen.Generator, string) {
+	t.Helper()
+
+	out := t.TempDir()
+
+	opts = append([]configen.Option{
+		configen.WithTemplates("testdata/templates"),
+		configen.WithSchemas("testdata/schemas"),
+		configen.WithValues("testdata/values.yaml"),
+		configen.WithOutput(filepath.Join(out, "{{.Env}}")),
+		configen.WithEnv("dev", "prod"),
+	}, opts...)
+
+	return configen.New(opts...), out
+}
+
+func TestGenerator_Render(t *testing.T) {
+	t.Parallel()
+
+	g, out := newGenerator(t, configen.WithJobs(4))
+
+	result, err := g.Render()
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Files, 2)
+
+	for _, file := range result.Files {
+		assert.Equal(t, filepath.Join(out, file.Env, "service.yaml"), file.Path)
+		assert.Equal(t, "yaml", file.Format)
+		assert.Equal(t, "https://example.com/service.schema.json", file.Schema)
+		assert.FileExists(t, file.Path)
+	}
+}
+
+func TestGenerator_Render_fs(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"templates/_helpers.tpl":  {Data: []byte(`{{define "name"}}{{.Values.name}}{{end}}`)},
+		"templates/app/conf.yaml": {Data: []byte("$format: json\nname: {{include \"name\" .}}\n")},
+		"static/robots.txt":       {Data: []byte("User-agent: *\n"), Mode: 0644},
+		"values.yaml":             {Data: []byte("name: demo\n")},
+	}
+
+	sink := configen.NewMemorySink()
+
+	g := configen.New(
+		configen.WithFS(fsys),
+		configen.WithSink(sink),
+		configen.WithTemplates("templates"),
+		configen.WithRaws("static"),
+		configen.WithValues("values.yaml"),
+	)
+
+	result, err := g.Render()
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Files, 2)
+	assert.Equal(t, []string{"dist/app/conf.json", "dist/robots.txt"}, sink.Names())
+	assert.Equal(t, "{\n  \"name\": \"demo\"\n}", string(sink.Files()["dist/app/conf.json"]))
+}
+
+func TestTarSink(t *testing.T) {
+	t.Parallel()
+
+	var buff bytes.Buffer
+
+	sink := configen.NewTarSink(&buff)
+
+	assert.Nil(t, sink.WriteFile(filepath.Join("dist", "foo.txt"), []byte("foo"), 0644))
+	assert.Nil(t, sink.Close())
+
+	r := tar.NewReader(&buff)
+
+	hdr, err := r.Next()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "dist/foo.txt", hdr.Name)
+	assert.Equal(t, int64(3), hdr.Size)
+}
+
+func TestGenerator_Validate(t *testing.T) {
+	t.Parallel()
+
+	g, out := newGenerator(t, configen.WithSet("replicas", "many"))
+
+	result, err := g.Validate()
+
+	assert.True(t, errors.Is(err, configen.ErrValidationError))
+	assert.Len(t, result.Failed(), 2)
+	assert.NoDirExists(t, filepath.Join(out, "dev"))
+}
+
+func TestGenerator_ValidateDocument(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newGenerator(t)
+
+	schema := "https://example.com/service.schema.json"
+
+	assert.Nil(t, g.ValidateDocument(schema, map[string]interface{}{"name": "demo", "replicas": 1}))
+	err := g.ValidateDocument(schema, map[string]interface{}{"name": "demo"})
+
+	assert.True(t, errors.Is(err, configen.ErrValidationError))
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	c, err := configen.Parse([]byte(`name = "demo"`), "toml")
+
+	assert.Nil(t, err)
+	assert.Equal(t, configen.Context{"name": "demo"}, c)
+
+	_, err = configen.Parse([]byte(`name = "demo"`), "ini")
+
+	assert.True(t, errors.Is(err, configen.ErrUnknownFormat))
+}
@@ -0,0 +1,369 @@
+// MIT License
+//
+// Copyright (c) 2021 Iván Szkiba
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package configen
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Option configures a Generator.
+type Option func(*Generator)
+
+// WithTemplates adds template input directories (default: templates).
+func WithTemplates(dirs ...string) Option {
+	return func(g *Generator) {
+		g.opts.Templates = append(g.opts.Templates, dirs...)
+	}
+}
+
+// WithRaws adds raw input directories, copied to the output as is.
+func WithRaws(dirs ...string) Option {
+	return func(g *Generator) {
+		g.opts.Raws = append(g.opts.Raws, dirs...)
+	}
+}
+
+// WithSchemas adds JSON schema directories.
+func WithSchemas(dirs ...string) Option {
+	return func(g *Generator) {
+		g.opts.Schemas = append(g.opts.Schemas, dirs...)
+	}
+}
+
+// WithValues adds data values files or directories. Sources can be given instead of files: env:PREFIX (environment
+// variables named PREFIX__KEY__KEY), exec:command (output of the command) and - (standard input).
+func WithValues(files ...string) Option {
+	return func(g *Generator) {
+		g.opts.Values = append(g.opts.Values, files...)
+	}
+}
+
+// WithValuesDirKeys places the values of files in values directories under their relative path
+// (db/primary.yaml: db.primary) instead of merging them at the top level.
+func WithValuesDirKeys() Option {
+	return func(g *Generator) {
+		g.opts.ValuesDirKeys = true
+	}
+}
+
+// WithAgeKey sets the age identity file decrypting encrypted values files
+// (default: the file named by SOPS_AGE_KEY_FILE, or the identity in SOPS_AGE_KEY).
+func WithAgeKey(file string) Option {
+	return func(g *Generator) {
+		g.opts.AgeKeyFile = file
+	}
+}
+
+// WithSecrets sets the secret provider of the secret template function.
+// Lookups are cached during a generation run.
+func WithSecrets(provider SecretProvider) Option {
+	return func(g *Generator) {
+		g.opts.SecretProvider = provider
+	}
+}
+
+// WithSecretsAudit sets the writer of the audit log of secret lookups (JSON lines, without secret values).
+func WithSecretsAudit(w io.Writer) Option {
+	return func(g *Generator) {
+		g.opts.Audit = w
+	}
+}
+
+// WithValuesCache sets the cache directory of remote (https://) values files (default: the user cache directory).
+func WithValuesCache(dir string) Option {
+	return func(g *Generator) {
+		g.opts.ValuesCache = dir
+	}
+}
+
+// WithHTTPClient sets the HTTP client fetching remote (https://) values files.
+func WithHTTPClient(client *http.Client) Option {
+	return func(g *Generator) {
+		g.opts.HTTPClient = client
+	}
+}
+
+// WithExecTimeout sets the timeout of commands of exec: values sources (default: 1m).
+func WithExecTimeout(d time.Duration) Option {
+	return func(g *Generator) {
+		g.opts.ExecTimeout = d
+	}
+}
+
+// WithValuesFormat sets the format of values read from standard input or command output (default: yaml).
+func WithValuesFormat(format string) Option {
+	return func(g *Generator) {
+		g.opts.ValuesFormat = format
+	}
+}
+
+// WithStdin sets the reader of values given as - (default: os.Stdin). It is read only once.
+func WithStdin(r io.Reader) Option {
+	return func(g *Generator) {
+		g.opts.Stdin = r
+	}
+}
+
+// WithSet sets a single value. The name may be a path like a.b[0].c, the type of the value
+// is inferred as a YAML scalar (number, boolean, null or string).
+func WithSet(name, value string) Option {
+	return func(g *Generator) {
+		g.opts.Define[name] = value
+	}
+}
+
+// WithSetString sets a single string value, without type inference.
+func WithSetString(name, value string) Option {
+	return func(g *Generator) {
+		g.opts.DefineString[name] = value
+	}
+}
+
+// WithSetJSON sets a single value given as JSON.
+func WithSetJSON(name, value string) Option {
+	return func(g *Generator) {
+		g.opts.DefineJSON[name] = value
+	}
+}
+
+// WithSetFile sets a single value to the content of the file.
+func WithSetFile(name, file string) Option {
+	return func(g *Generator) {
+		g.opts.DefineFile[name] = file
+	}
+}
+
+// WithMerge sets the merge strategy of values files: MergeKeepFirst (default) or MergeOverride.
+func WithMerge(strategy string) Option {
+	return func(g *Generator) {
+		g.opts.Merge = strategy
+	}
+}
+
+// WithMergeLists sets how lists of values files are merged: ListsReplace (default), ListsAppend
+// or ListsMergePrefix followed by the name of the field identifying the items.
+func WithMergeLists(mode string) Option {
+	return func(g *Generator) {
+		g.opts.MergeLists = mode
+	}
+}
+
+// WithMergeNulls sets how null values of values files are handled: NullsIgnore (default) or NullsDelete.
+func WithMergeNulls(mode string) Option {
+	return func(g *Generator) {
+		g.opts.MergeNulls = mode
+	}
+}
+
+// WithOutput sets the output directory (default: dist, or dist/{{.Env}} if environments are given).
+func WithOutput(dir string) Option {
+	return func(g *Generator) {
+		g.opts.Output = dir
+	}
+}
+
+// WithPackage sets the package descriptor template.
+func WithPackage(file string) Option {
+	return func(g *Generator) {
+		g.opts.Package = file
+	}
+}
+
+// WithEnv adds staging environments.
+func WithEnv(envs ...string) Option {
+	return func(g *Generator) {
+		g.envs = append(g.envs, envs...)
+	}
+}
+
+// WithInherit declares parent as the parent environment of env. Values files, template and raw directories
+// are layered along the inheritance chain, the more specific environment taking precedence.
+func WithInherit(env, parent string) Option {
+	return func(g *Generator) {
+		if g.opts.Inherit == nil {
+			g.opts.Inherit = make(map[string]string)
+		}
+
+		g.opts.Inherit[env] = parent
+	}
+}
+
+// WithAxis adds a matrix dimension: every environment is generated for every value of the dimension.
+// The value is available in path templates and templates as {{.name}} (and {{.Dims.name}}).
+func WithAxis(name string, values ...string) Option {
+	return func(g *Generator) {
+		g.opts.Axes = append(g.opts.Axes, name+"="+strings.Join(values, ","))
+	}
+}
+
+// WithAxisExclude skips the combinations of dimensions matching all of the given name/value pairs.
+// The env name matches the environment.
+func WithAxisExclude(dims map[string]string) Option {
+	return func(g *Generator) {
+		pairs := make([]string, 0, len(dims))
+
+		for name, value := range dims {
+			pairs = append(pairs, name+"="+value)
+		}
+
+		sort.Strings(pairs)
+
+		g.opts.AxisExclude = append(g.opts.AxisExclude, strings.Join(pairs, ","))
+	}
+}
+
+// WithProject uses the settings of a project file (see LoadProject) for the options not given otherwise.
+func WithProject(project *Project) Option {
+	return func(g *Generator) {
+		g.project = project
+	}
+}
+
+// WithLoose disables schema validation.
+func WithLoose() Option {
+	return func(g *Generator) {
+		g.opts.Loose = true
+	}
+}
+
+// WithDump enables writing intermediate files.
+func WithDump() Option {
+	return func(g *Generator) {
+		g.opts.Dump = true
+	}
+}
+
+// WithPrune enables removing files not generated by the run from the output directories.
+// Files matching any of the ignore glob patterns (relative to the output directory) are kept.
+func WithPrune(ignore ...string) Option {
+	return func(g *Generator) {
+		g.opts.Prune = true
+		g.opts.PruneIgnore = append(g.opts.PruneIgnore, ignore...)
+	}
+}
+
+// WithAtomic requires replacing the output directories only if every file has been generated.
+// This is the default if possible; with this option generation fails if output directories are not dedicated ones.
+func WithAtomic() Option {
+	return func(g *Generator) {
+		g.opts.Atomic = true
+	}
+}
+
+// WithNoAtomic disables staging, output files are written in place.
+func WithNoAtomic() Option {
+	return func(g *Generator) {
+		g.opts.NoAtomic = true
+	}
+}
+
+// WithManifest enables writing the manifest of generated files (with checksums and sources).
+// A relative name is placed into the common output directory.
+func WithManifest(name string) Option {
+	return func(g *Generator) {
+		g.opts.Manifest = name
+	}
+}
+
+// WithSince enables regenerating only the outputs affected by files changed since the given git revision.
+// The dependencies of the outputs are read from the manifest of the previous run (see WithManifest).
+func WithSince(revision string) Option {
+	return func(g *Generator) {
+		g.opts.Since = revision
+	}
+}
+
+// WithDebounce sets how long Watch waits for changes to settle before regenerating (default: 100ms).
+func WithDebounce(d time.Duration) Option {
+	return func(g *Generator) {
+		g.opts.Debounce = d
+	}
+}
+
+// WithJobs sets the number of files generated in parallel (default: 1).
+func WithJobs(n int) Option {
+	return func(g *Generator) {
+		g.opts.Jobs = n
+	}
+}
+
+// WithStdout sets the writer of template console output (default: discard).
+func WithStdout(w io.Writer) Option {
+	return func(g *Generator) {
+		g.opts.Stdout = w
+	}
+}
+
+// WithStderr sets the writer of diagnostic messages (default: discard).
+func WithStderr(w io.Writer) Option {
+	return func(g *Generator) {
+		g.opts.Stderr = w
+	}
+}
+
+// WithFS sets the file system of input files (default: the operating system's file system).
+// Watch mode always uses the operating system's file system.
+func WithFS(fsys fs.FS) Option {
+	return func(g *Generator) {
+		g.opts.FS = fsys
+	}
+}
+
+// WithSink sets the receiver of output files (default: DirSink).
+func WithSink(sink OutputSink) Option {
+	return func(g *Generator) {
+		g.opts.Sink = sink
+	}
+}
+
+func (g *Generator) applyDefaults() {
+	if g.project != nil {
+		if len(g.envs) == 0 {
+			g.envs = g.project.Envs()
+		}
+
+		g.project.Apply(&g.opts)
+	}
+
+	if len(g.opts.Templates) == 0 {
+		g.opts.Templates = []string{"templates"}
+	}
+
+	if len(g.opts.Output) == 0 {
+		if len(g.envs) == 0 {
+			g.opts.Output = "dist"
+		} else {
+			g.opts.Output = filepath.Join("dist", "{{.Env}}")
+		}
+	}
+
+	if len(g.envs) == 0 {
+		g.envs = []string{""}
+	}
+}